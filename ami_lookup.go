@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Custom resource properties that select the AMI
+const (
+	amiPropertyNamePattern        = "NamePattern"
+	amiPropertyOwners             = "Owners"
+	amiPropertyArchitecture       = "Architecture"
+	amiPropertyVirtualizationType = "VirtualizationType"
+	amiPropertyRootDeviceType     = "RootDeviceType"
+	// Optional AMI ID that's returned without a lookup
+	amiPropertyPinnedAMI = "PinnedAMI"
+	// Policy that selects one of the matching images
+	amiPropertySelectionPolicy = "SelectionPolicy"
+	amiPropertySoakDays        = "SoakDays"
+	amiPropertyImageName       = "ImageName"
+	// Changes every provision s.t. CloudFormation sends an Update request
+	// and the lookup is re-run
+	amiPropertyLookupTime = "LookupTime"
+)
+
+// Default AMI lookup, which finds the latest Ubuntu 16.04 release
+const (
+	defaultAMINamePattern        = "*hvm-ssd/ubuntu-xenial-16.04-amd64-server*"
+	defaultAMIOwner              = "099720109477" // Canonical
+	defaultAMIArchitecture       = "x86_64"
+	defaultAMIVirtualizationType = "hvm"
+	defaultAMIRootDeviceType     = "ebs"
+	defaultAMISelectionPolicy    = imageSelectionNewest
+)
+
+// amiLookup describes the DescribeImages filters used to find the
+// Concourse AMI
+type amiLookup struct {
+	NamePattern        string
+	Owners             []string
+	Architecture       string
+	VirtualizationType string
+	RootDeviceType     string
+	PinnedAMI          string
+	SelectionPolicy    string
+	SoakDays           int
+	ImageName          string
+}
+
+// Return the custom resource properties for the AMI lookup options
+func (lookup *amiLookup) properties() map[string]interface{} {
+	return map[string]interface{}{
+		amiPropertyNamePattern:        lookup.NamePattern,
+		amiPropertyOwners:             lookup.Owners,
+		amiPropertyArchitecture:       lookup.Architecture,
+		amiPropertyVirtualizationType: lookup.VirtualizationType,
+		amiPropertyRootDeviceType:     lookup.RootDeviceType,
+		amiPropertyPinnedAMI:          lookup.PinnedAMI,
+		amiPropertySelectionPolicy:    lookup.SelectionPolicy,
+		amiPropertySoakDays:           lookup.SoakDays,
+		amiPropertyImageName:          lookup.ImageName,
+		amiPropertyLookupTime:         time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// Return the string property or defaultValue if it's unset
+func stringProperty(properties map[string]interface{}, name string, defaultValue string) (string, error) {
+	value, exists := properties[name]
+	if !exists || nil == value {
+		return defaultValue, nil
+	}
+	typedValue, typedValueOk := value.(string)
+	if !typedValueOk {
+		return "", fmt.Errorf("Property %s must be a string: %#v", name, value)
+	}
+	if "" == typedValue {
+		return defaultValue, nil
+	}
+	return typedValue, nil
+}
+
+// Return the integer property, which may also be a numeric string, or
+// defaultValue if it's unset. CloudFormation passes custom resource
+// properties as strings.
+func intProperty(properties map[string]interface{}, name string, defaultValue int) (int, error) {
+	switch typedValue := properties[name].(type) {
+	case nil:
+		return defaultValue, nil
+	case int:
+		return typedValue, nil
+	case float64:
+		return int(typedValue), nil
+	case string:
+		if "" == typedValue {
+			return defaultValue, nil
+		}
+		intValue, intValueErr := strconv.Atoi(typedValue)
+		if nil != intValueErr {
+			return 0, fmt.Errorf("Property %s must be an integer: %#v", name, typedValue)
+		}
+		return intValue, nil
+	default:
+		return 0, fmt.Errorf("Property %s must be an integer: %#v", name, typedValue)
+	}
+}
+
+// Return the string list property, which may also be a comma separated
+// string, or defaultValue if it's unset
+func stringListProperty(properties map[string]interface{}, name string, defaultValue []string) ([]string, error) {
+	var values []string
+	switch typedValue := properties[name].(type) {
+	case nil:
+	case string:
+		for _, eachValue := range strings.Split(typedValue, ",") {
+			if trimmed := strings.TrimSpace(eachValue); "" != trimmed {
+				values = append(values, trimmed)
+			}
+		}
+	case []string:
+		values = typedValue
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			stringValue, stringValueOk := eachValue.(string)
+			if !stringValueOk {
+				return nil, fmt.Errorf("Property %s must be a list of strings: %#v", name, typedValue)
+			}
+			values = append(values, stringValue)
+		}
+	default:
+		return nil, fmt.Errorf("Property %s must be a list of strings: %#v", name, typedValue)
+	}
+	if len(values) <= 0 {
+		return defaultValue, nil
+	}
+	return values, nil
+}
+
+// Return the AMI lookup defined by the custom resource properties. Unset
+// properties use the Ubuntu 16.04 defaults.
+func newAMILookup(properties map[string]interface{}) (*amiLookup, error) {
+	lookup := &amiLookup{}
+	var propertyErr error
+	stringProperties := []struct {
+		name         string
+		defaultValue string
+		value        *string
+	}{
+		{amiPropertyNamePattern, defaultAMINamePattern, &lookup.NamePattern},
+		{amiPropertyArchitecture, defaultAMIArchitecture, &lookup.Architecture},
+		{amiPropertyVirtualizationType, defaultAMIVirtualizationType, &lookup.VirtualizationType},
+		{amiPropertyRootDeviceType, defaultAMIRootDeviceType, &lookup.RootDeviceType},
+		{amiPropertySelectionPolicy, defaultAMISelectionPolicy, &lookup.SelectionPolicy},
+		{amiPropertyImageName, "", &lookup.ImageName},
+	}
+	for _, eachProperty := range stringProperties {
+		*eachProperty.value, propertyErr = stringProperty(properties, eachProperty.name, eachProperty.defaultValue)
+		if nil != propertyErr {
+			return nil, propertyErr
+		}
+	}
+	lookup.PinnedAMI, propertyErr = stringProperty(properties, amiPropertyPinnedAMI, "")
+	if nil != propertyErr {
+		return nil, propertyErr
+	}
+	lookup.SoakDays, propertyErr = intProperty(properties, amiPropertySoakDays, 0)
+	if nil != propertyErr {
+		return nil, propertyErr
+	}
+	lookup.Owners, propertyErr = stringListProperty(properties, amiPropertyOwners, []string{defaultAMIOwner})
+	if nil != propertyErr {
+		return nil, propertyErr
+	}
+	return lookup, nil
+}
+
+// Return the DescribeImages request for the lookup
+func (lookup *amiLookup) describeImagesInput() *ec2.DescribeImagesInput {
+	filters := []*ec2.Filter{}
+	for _, eachFilter := range [][]string{
+		{"name", lookup.NamePattern},
+		{"root-device-type", lookup.RootDeviceType},
+		{"architecture", lookup.Architecture},
+		{"virtualization-type", lookup.VirtualizationType},
+	} {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(eachFilter[0]),
+			Values: []*string{aws.String(eachFilter[1])},
+		})
+	}
+	return &ec2.DescribeImagesInput{
+		Filters: filters,
+		Owners:  aws.StringSlice(lookup.Owners),
+	}
+}
+
+// imageDescriber is the subset of the EC2 API used by the AMI lookup
+type imageDescriber interface {
+	DescribeImages(*ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error)
+}
+
+// Verify the AMI selection options
+func validateAMIOptions() error {
+	lookup := options.AMILookup
+	if "" == lookup.SelectionPolicy {
+		lookup.SelectionPolicy = defaultAMISelectionPolicy
+	}
+	_, selectorErr := newImageSelector(&lookup, time.Now())
+	return selectorErr
+}
+
+// Return the AMI lookup custom resource outputs for the request. Create and
+// Update requests select a matching AMI, unless it's pinned, s.t. stack
+// updates roll the launch configuration to newer images. Delete requests
+// are a no-op.
+func amiCustomResourceOutputs(requestType string,
+	properties map[string]interface{},
+	ec2Svc imageDescriber,
+	logger *logrus.Logger) (map[string]interface{}, error) {
+
+	switch requestType {
+	case "Create", "Update":
+	case "Delete":
+		return map[string]interface{}{}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported custom resource request type: %s", requestType)
+	}
+
+	// Setup the filters
+	lookup, lookupErr := newAMILookup(properties)
+	if nil != lookupErr {
+		return nil, lookupErr
+	}
+	logger.WithFields(logrus.Fields{
+		"RequestType": requestType,
+		"Lookup":      lookup,
+	}).Info("AMI lookup")
+
+	// Set the HVM type. The pinned AMI's metadata isn't looked up.
+	outputProps := map[string]interface{}{
+		"HVM":          lookup.PinnedAMI,
+		"Name":         "",
+		"CreationDate": "",
+	}
+	if "" == lookup.PinnedAMI {
+		selector, selectorErr := newImageSelector(lookup, time.Now())
+		if nil != selectorErr {
+			return nil, selectorErr
+		}
+		// Get the HVM AMIs
+		describeImagesOutput, describeImagesOutputErr := ec2Svc.DescribeImages(lookup.describeImagesInput())
+		if nil != describeImagesOutputErr {
+			return nil, describeImagesOutputErr
+		}
+		logger.WithFields(logrus.Fields{
+			"DescribeImagesOutput": describeImagesOutput,
+		}).Debug("Results")
+
+		image, imageErr := selector.selectImage(describeImagesOutput.Images, logger)
+		if nil != imageErr {
+			return nil, imageErr
+		}
+		outputProps["HVM"] = image.ID
+		outputProps["Name"] = image.Name
+		outputProps["CreationDate"] = image.CreationDate.Format(time.RFC3339)
+	}
+	logger.WithFields(logrus.Fields{
+		"Outputs": outputProps,
+	}).Info("CustomResource outputs")
+	return outputProps, nil
+}
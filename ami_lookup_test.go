@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// fakeImageDescriber returns canned images and records the requests
+type fakeImageDescriber struct {
+	inputs []*ec2.DescribeImagesInput
+	images []*ec2.Image
+	err    error
+}
+
+func (describer *fakeImageDescriber) DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error) {
+	describer.inputs = append(describer.inputs, input)
+	if nil != describer.err {
+		return nil, describer.err
+	}
+	return &ec2.DescribeImagesOutput{Images: describer.images}, nil
+}
+
+// Return an available image
+func newTestImage(imageID string, name string, creationDate string) *ec2.Image {
+	image := &ec2.Image{
+		ImageId: aws.String(imageID),
+		Name:    aws.String(name),
+		State:   aws.String(ec2.ImageStateAvailable),
+	}
+	if "" != creationDate {
+		image.CreationDate = aws.String(creationDate)
+	}
+	return image
+}
+
+func newTestImageDescriber() *fakeImageDescriber {
+	return &fakeImageDescriber{
+		images: []*ec2.Image{
+			newTestImage("ami-older", "xenial-20170101", "2017-01-01T00:00:00Z"),
+			newTestImage("ami-newer", "xenial-20170201", "2017-02-01T00:00:00Z"),
+		},
+	}
+}
+
+// Return the filter values by name
+func describeImagesFilters(input *ec2.DescribeImagesInput) map[string]string {
+	filters := make(map[string]string)
+	for _, eachFilter := range input.Filters {
+		filters[aws.StringValue(eachFilter.Name)] = aws.StringValue(eachFilter.Values[0])
+	}
+	return filters
+}
+
+func TestAMICustomResourceCreateAndUpdate(t *testing.T) {
+	for _, eachRequestType := range []string{"Create", "Update"} {
+		describer := newTestImageDescriber()
+		outputs, outputsErr := amiCustomResourceOutputs(eachRequestType,
+			map[string]interface{}{},
+			describer,
+			logrus.New())
+		if nil != outputsErr {
+			t.Fatal(outputsErr)
+		}
+		if outputs["HVM"] != "ami-newer" ||
+			outputs["Name"] != "xenial-20170201" ||
+			outputs["CreationDate"] != "2017-02-01T00:00:00Z" {
+			t.Fatalf("%s: unexpected outputs: %#v", eachRequestType, outputs)
+		}
+		if len(describer.inputs) != 1 {
+			t.Fatalf("%s: expected 1 DescribeImages request, got %d", eachRequestType, len(describer.inputs))
+		}
+		input := describer.inputs[0]
+		filters := describeImagesFilters(input)
+		if filters["name"] != defaultAMINamePattern ||
+			filters["architecture"] != defaultAMIArchitecture ||
+			filters["virtualization-type"] != defaultAMIVirtualizationType ||
+			filters["root-device-type"] != defaultAMIRootDeviceType {
+			t.Fatalf("%s: unexpected filters: %#v", eachRequestType, filters)
+		}
+		if len(input.Owners) != 1 || aws.StringValue(input.Owners[0]) != defaultAMIOwner {
+			t.Fatalf("%s: unexpected owners: %v", eachRequestType, aws.StringValueSlice(input.Owners))
+		}
+	}
+}
+
+func TestAMICustomResourceProperties(t *testing.T) {
+	describer := newTestImageDescriber()
+	// CloudFormation passes the properties as strings
+	outputs, outputsErr := amiCustomResourceOutputs("Update",
+		map[string]interface{}{
+			amiPropertyNamePattern:     "xenial-*",
+			amiPropertyOwners:          []interface{}{"111111111111", "222222222222"},
+			amiPropertySelectionPolicy: imageSelectionName,
+			amiPropertyImageName:       "xenial-20170101",
+			amiPropertySoakDays:        "0",
+		},
+		describer,
+		logrus.New())
+	if nil != outputsErr {
+		t.Fatal(outputsErr)
+	}
+	if outputs["HVM"] != "ami-older" {
+		t.Fatalf("Unexpected outputs: %#v", outputs)
+	}
+	input := describer.inputs[0]
+	if describeImagesFilters(input)["name"] != "xenial-*" || len(input.Owners) != 2 {
+		t.Fatalf("Unexpected DescribeImages request: %#v", input)
+	}
+}
+
+func TestAMICustomResourceDelete(t *testing.T) {
+	describer := newTestImageDescriber()
+	outputs, outputsErr := amiCustomResourceOutputs("Delete",
+		map[string]interface{}{},
+		describer,
+		logrus.New())
+	if nil != outputsErr {
+		t.Fatal(outputsErr)
+	}
+	if len(outputs) != 0 || len(describer.inputs) != 0 {
+		t.Fatalf("Expected Delete to be a no-op: %#v", outputs)
+	}
+}
+
+func TestAMICustomResourcePinnedAMI(t *testing.T) {
+	describer := newTestImageDescriber()
+	outputs, outputsErr := amiCustomResourceOutputs("Create",
+		map[string]interface{}{
+			amiPropertyPinnedAMI: "ami-pinned",
+		},
+		describer,
+		logrus.New())
+	if nil != outputsErr {
+		t.Fatal(outputsErr)
+	}
+	if outputs["HVM"] != "ami-pinned" || outputs["Name"] != "" || outputs["CreationDate"] != "" {
+		t.Fatalf("Unexpected outputs: %#v", outputs)
+	}
+	if len(describer.inputs) != 0 {
+		t.Fatal("Expected the pinned AMI to skip the lookup")
+	}
+}
+
+func TestAMICustomResourceErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		requestType string
+		properties  map[string]interface{}
+		describer   *fakeImageDescriber
+	}{
+		{"unknown request type", "Rollback", map[string]interface{}{}, newTestImageDescriber()},
+		{"invalid selection policy", "Create", map[string]interface{}{amiPropertySelectionPolicy: "oldest"}, newTestImageDescriber()},
+		{"invalid soak days", "Create", map[string]interface{}{amiPropertySoakDays: "ten"}, newTestImageDescriber()},
+		{"no matching images", "Create", map[string]interface{}{}, &fakeImageDescriber{}},
+		{"DescribeImages error", "Create", map[string]interface{}{}, &fakeImageDescriber{err: fmt.Errorf("throttled")}},
+	}
+	for _, eachCase := range testCases {
+		_, outputsErr := amiCustomResourceOutputs(eachCase.requestType,
+			eachCase.properties,
+			eachCase.describer,
+			logrus.New())
+		if nil == outputsErr {
+			t.Fatalf("%s: expected an error", eachCase.name)
+		}
+	}
+}
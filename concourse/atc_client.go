@@ -0,0 +1,298 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	configVersionHeader = "X-Concourse-Config-Version"
+	defaultTeamName     = "main"
+)
+
+// Pipeline is the ATC representation of a pipeline
+type Pipeline struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Paused   bool   `json:"paused"`
+	Public   bool   `json:"public"`
+	TeamName string `json:"team_name"`
+}
+
+// Build is the ATC representation of a build
+type Build struct {
+	ID           int    `json:"id"`
+	TeamName     string `json:"team_name"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	JobName      string `json:"job_name"`
+	URL          string `json:"url"`
+	APIURL       string `json:"api_url"`
+	PipelineName string `json:"pipeline_name"`
+	StartTime    int64  `json:"start_time"`
+	EndTime      int64  `json:"end_time"`
+}
+
+// ATCClient is a minimal client for the Concourse ATC HTTP API
+// Ref: https://github.com/concourse/atc/blob/master/routes.go
+type ATCClient struct {
+	baseURL    string
+	teamName   string
+	username   string
+	password   string
+	token      string
+	httpClient *http.Client
+}
+
+// NewATCClient returns a client for the team on the ATC at baseURL that
+// authenticates with the HTTP Basic Auth credentials
+func NewATCClient(baseURL string, teamName string, username string, password string) *ATCClient {
+	return &ATCClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		teamName:   teamName,
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{},
+	}
+}
+
+// Return the ATC error for an unexpected response status
+func responseError(response *http.Response) error {
+	body, _ := ioutil.ReadAll(response.Body)
+	return fmt.Errorf("Unexpected ATC response for %s %s: %s (%s)",
+		response.Request.Method,
+		response.Request.URL.Path,
+		response.Status,
+		strings.TrimSpace(string(body)))
+}
+
+// Return the team scoped API path
+func (client *ATCClient) teamPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/api/v1/teams/%s/%s",
+		url.PathEscape(client.teamName),
+		fmt.Sprintf(format, args...))
+}
+
+// Login exchanges the Basic Auth credentials for a bearer token
+func (client *ATCClient) Login() error {
+	httpReq, httpReqErr := http.NewRequest("GET",
+		client.baseURL+client.teamPath("auth/token"),
+		nil)
+	if nil != httpReqErr {
+		return httpReqErr
+	}
+	httpReq.SetBasicAuth(client.username, client.password)
+	response, responseErr := client.httpClient.Do(httpReq)
+	if nil != responseErr {
+		return responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+	var token struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	decodeErr := json.NewDecoder(response.Body).Decode(&token)
+	if nil != decodeErr {
+		return decodeErr
+	}
+	if "" == token.Value {
+		return fmt.Errorf("ATC returned an empty auth token")
+	}
+	client.token = token.Value
+	return nil
+}
+
+// Make an authenticated request. The token is fetched on first use and
+// refreshed once if the ATC rejects it.
+func (client *ATCClient) do(method string,
+	apiPath string,
+	body []byte,
+	headers map[string]string) (*http.Response, error) {
+	if "" == client.token {
+		loginErr := client.Login()
+		if nil != loginErr {
+			return nil, loginErr
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		var bodyReader io.Reader
+		if nil != body {
+			bodyReader = bytes.NewReader(body)
+		}
+		httpReq, httpReqErr := http.NewRequest(method, client.baseURL+apiPath, bodyReader)
+		if nil != httpReqErr {
+			return nil, httpReqErr
+		}
+		httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.token))
+		for eachKey, eachValue := range headers {
+			httpReq.Header.Set(eachKey, eachValue)
+		}
+		response, responseErr := client.httpClient.Do(httpReq)
+		if nil != responseErr {
+			return nil, responseErr
+		}
+		if response.StatusCode != http.StatusUnauthorized || attempt != 0 {
+			return response, nil
+		}
+		response.Body.Close()
+		loginErr := client.Login()
+		if nil != loginErr {
+			return nil, loginErr
+		}
+	}
+}
+
+// Make an authenticated GET request and decode the JSON response
+func (client *ATCClient) getJSON(apiPath string, output interface{}) error {
+	response, responseErr := client.do("GET", apiPath, nil, nil)
+	if nil != responseErr {
+		return responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+	return json.NewDecoder(response.Body).Decode(output)
+}
+
+// PipelineConfig returns the JSON config and config version of the named
+// pipeline. The version is empty if the pipeline doesn't exist.
+func (client *ATCClient) PipelineConfig(pipelineName string) (json.RawMessage, string, error) {
+	response, responseErr := client.do("GET",
+		client.teamPath("pipelines/%s/config", url.PathEscape(pipelineName)),
+		nil,
+		nil)
+	if nil != responseErr {
+		return nil, "", responseErr
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		var configResponse struct {
+			Config json.RawMessage `json:"config"`
+		}
+		decodeErr := json.NewDecoder(response.Body).Decode(&configResponse)
+		if nil != decodeErr {
+			return nil, "", decodeErr
+		}
+		return configResponse.Config, response.Header.Get(configVersionHeader), nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	default:
+		return nil, "", responseError(response)
+	}
+}
+
+// SetPipelineConfig saves the YAML config for the named pipeline, creating
+// it if needed. The save is retried once if another client updated the
+// pipeline between reading the config version and the PUT.
+func (client *ATCClient) SetPipelineConfig(pipelineName string, config []byte) error {
+	for attempt := 0; ; attempt++ {
+		_, configVersion, configVersionErr := client.PipelineConfig(pipelineName)
+		if nil != configVersionErr {
+			return configVersionErr
+		}
+		if "" == configVersion {
+			configVersion = "0"
+		}
+		response, responseErr := client.do("PUT",
+			client.teamPath("pipelines/%s/config", url.PathEscape(pipelineName)),
+			config,
+			map[string]string{
+				"Content-Type":      "application/x-yaml",
+				configVersionHeader: configVersion,
+			})
+		if nil != responseErr {
+			return responseErr
+		}
+		if response.StatusCode == http.StatusConflict && attempt == 0 {
+			response.Body.Close()
+			continue
+		}
+		defer response.Body.Close()
+		if response.StatusCode == http.StatusOK ||
+			response.StatusCode == http.StatusCreated {
+			return nil
+		}
+		return responseError(response)
+	}
+}
+
+// Make an authenticated request that expects an empty 2XX response
+func (client *ATCClient) doAction(method string, apiPath string) error {
+	response, responseErr := client.do(method, apiPath, nil, nil)
+	if nil != responseErr {
+		return responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return responseError(response)
+	}
+	return nil
+}
+
+// UnpausePipeline unpauses the named pipeline
+func (client *ATCClient) UnpausePipeline(pipelineName string) error {
+	return client.doAction("PUT",
+		client.teamPath("pipelines/%s/unpause", url.PathEscape(pipelineName)))
+}
+
+// DestroyPipeline deletes the named pipeline
+func (client *ATCClient) DestroyPipeline(pipelineName string) error {
+	return client.doAction("DELETE",
+		client.teamPath("pipelines/%s", url.PathEscape(pipelineName)))
+}
+
+// ListPipelines returns the team's pipelines
+func (client *ATCClient) ListPipelines() ([]Pipeline, error) {
+	var pipelines []Pipeline
+	pipelinesErr := client.getJSON(client.teamPath("pipelines"), &pipelines)
+	if nil != pipelinesErr {
+		return nil, pipelinesErr
+	}
+	return pipelines, nil
+}
+
+// ListBuilds returns the builds of the named pipeline
+func (client *ATCClient) ListBuilds(pipelineName string) ([]Build, error) {
+	var builds []Build
+	buildsErr := client.getJSON(client.teamPath("pipelines/%s/builds",
+		url.PathEscape(pipelineName)),
+		&builds)
+	if nil != buildsErr {
+		return nil, buildsErr
+	}
+	return builds, nil
+}
+
+// CreateJobBuild triggers a build of the named job
+func (client *ATCClient) CreateJobBuild(pipelineName string, jobName string) (*Build, error) {
+	response, responseErr := client.do("POST",
+		client.teamPath("pipelines/%s/jobs/%s/builds",
+			url.PathEscape(pipelineName),
+			url.PathEscape(jobName)),
+		nil,
+		nil)
+	if nil != responseErr {
+		return nil, responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		return nil, responseError(response)
+	}
+	var build Build
+	decodeErr := json.NewDecoder(response.Body).Decode(&build)
+	if nil != decodeErr {
+		return nil, decodeErr
+	}
+	return &build, nil
+}
@@ -0,0 +1,293 @@
+package concourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testUsername = "picard"
+	testPassword = "captain"
+)
+
+// fakeATC is an httptest ATC that issues numbered tokens and records the
+// requests it receives
+type fakeATC struct {
+	server        *httptest.Server
+	logins        int
+	validToken    string
+	configVersion string
+	// Number of PUT config requests rejected with a 409
+	conflicts  int
+	putConfigs []*http.Request
+	putBodies  []string
+	requests   []string
+	pipelines  []Pipeline
+	builds     map[string][]Build
+}
+
+func newFakeATC() *fakeATC {
+	atc := &fakeATC{
+		configVersion: "7",
+		builds:        make(map[string][]Build),
+	}
+	atc.server = httptest.NewServer(atc)
+	return atc
+}
+
+func (atc *fakeATC) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atc.requests = append(atc.requests, req.Method+" "+req.URL.Path)
+	if req.URL.Path == "/api/v1/teams/main/auth/token" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != testUsername || password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atc.logins++
+		atc.validToken = fmt.Sprintf("token-%d", atc.logins)
+		json.NewEncoder(w).Encode(map[string]string{
+			"type":  "Bearer",
+			"value": atc.validToken,
+		})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer "+atc.validToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch req.Method + " " + req.URL.Path {
+	case "GET /api/v1/teams/main/pipelines/existing/config":
+		w.Header().Set(configVersionHeader, atc.configVersion)
+		fmt.Fprint(w, `{"config":{"jobs":[]}}`)
+	case "PUT /api/v1/teams/main/pipelines/existing/config",
+		"PUT /api/v1/teams/main/pipelines/new/config":
+		body, _ := ioutil.ReadAll(req.Body)
+		atc.putConfigs = append(atc.putConfigs, req)
+		atc.putBodies = append(atc.putBodies, string(body))
+		if atc.conflicts > 0 {
+			atc.conflicts--
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "PUT /api/v1/teams/main/pipelines/existing/unpause":
+		w.WriteHeader(http.StatusOK)
+	case "DELETE /api/v1/teams/main/pipelines/removed":
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /api/v1/teams/main/pipelines":
+		json.NewEncoder(w).Encode(atc.pipelines)
+	case "GET /api/v1/teams/main/pipelines/existing/builds":
+		json.NewEncoder(w).Encode(atc.builds["existing"])
+	case "POST /api/v1/teams/main/pipelines/existing/jobs/build/builds":
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Build{
+			ID:           43,
+			Name:         "4",
+			Status:       "pending",
+			JobName:      "build",
+			PipelineName: "existing",
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestATCClient(atc *fakeATC) *ATCClient {
+	return NewATCClient(atc.server.URL+"/", defaultTeamName, testUsername, testPassword)
+}
+
+func TestATCClientLogin(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	client := newTestATCClient(atc)
+	loginErr := client.Login()
+	if nil != loginErr {
+		t.Fatal(loginErr)
+	}
+	if client.token != "token-1" {
+		t.Fatalf("Unexpected token: %s", client.token)
+	}
+	badClient := NewATCClient(atc.server.URL, defaultTeamName, testUsername, "wrong")
+	if nil == badClient.Login() {
+		t.Fatal("Expected invalid credentials to fail")
+	}
+}
+
+func TestATCClientSetPipelineConfig(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	client := newTestATCClient(atc)
+	setErr := client.SetPipelineConfig("existing", []byte("jobs: []"))
+	if nil != setErr {
+		t.Fatal(setErr)
+	}
+	if len(atc.putConfigs) != 1 {
+		t.Fatalf("Expected 1 PUT, got %d", len(atc.putConfigs))
+	}
+	putReq := atc.putConfigs[0]
+	if putReq.Header.Get(configVersionHeader) != "7" {
+		t.Fatalf("Unexpected config version: %s", putReq.Header.Get(configVersionHeader))
+	}
+	if putReq.Header.Get("Content-Type") != "application/x-yaml" || atc.putBodies[0] != "jobs: []" {
+		t.Fatalf("Unexpected PUT: %s %s", putReq.Header.Get("Content-Type"), atc.putBodies[0])
+	}
+
+	// New pipelines don't have a config version
+	setErr = client.SetPipelineConfig("new", []byte("jobs: []"))
+	if nil != setErr {
+		t.Fatal(setErr)
+	}
+	if version := atc.putConfigs[1].Header.Get(configVersionHeader); version != "0" {
+		t.Fatalf("Unexpected config version for a new pipeline: %s", version)
+	}
+}
+
+func TestATCClientSetPipelineConfigConflict(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	// A single conflict is retried with the current version
+	atc.conflicts = 1
+	client := newTestATCClient(atc)
+	setErr := client.SetPipelineConfig("existing", []byte("jobs: []"))
+	if nil != setErr {
+		t.Fatal(setErr)
+	}
+	if len(atc.putConfigs) != 2 {
+		t.Fatalf("Expected 2 PUTs, got %d", len(atc.putConfigs))
+	}
+
+	// Repeated conflicts fail
+	atc.conflicts = 2
+	atc.putConfigs = nil
+	setErr = client.SetPipelineConfig("existing", []byte("jobs: []"))
+	if nil == setErr {
+		t.Fatal("Expected repeated conflicts to fail")
+	}
+	if len(atc.putConfigs) != 2 {
+		t.Fatalf("Expected 2 PUTs, got %d", len(atc.putConfigs))
+	}
+}
+
+func TestATCClientUnpausePipeline(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	client := newTestATCClient(atc)
+	unpauseErr := client.UnpausePipeline("existing")
+	if nil != unpauseErr {
+		t.Fatal(unpauseErr)
+	}
+	lastRequest := atc.requests[len(atc.requests)-1]
+	if lastRequest != "PUT /api/v1/teams/main/pipelines/existing/unpause" {
+		t.Fatalf("Unexpected request: %s", lastRequest)
+	}
+	if nil == client.UnpausePipeline("missing") {
+		t.Fatal("Expected unpausing a missing pipeline to fail")
+	}
+}
+
+func TestATCClientListPipelinesAndBuilds(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	atc.pipelines = []Pipeline{
+		{Name: "existing", Paused: false, TeamName: defaultTeamName},
+		{Name: "other", Paused: true, TeamName: defaultTeamName},
+	}
+	atc.builds["existing"] = []Build{
+		{ID: 42, Name: "3", Status: "succeeded", JobName: "build", PipelineName: "existing"},
+	}
+	client := newTestATCClient(atc)
+	pipelines, pipelinesErr := client.ListPipelines()
+	if nil != pipelinesErr {
+		t.Fatal(pipelinesErr)
+	}
+	if len(pipelines) != 2 || pipelines[0].Name != "existing" || !pipelines[1].Paused {
+		t.Fatalf("Unexpected pipelines: %#v", pipelines)
+	}
+	builds, buildsErr := client.ListBuilds("existing")
+	if nil != buildsErr {
+		t.Fatal(buildsErr)
+	}
+	if len(builds) != 1 || builds[0].ID != 42 || builds[0].Status != "succeeded" {
+		t.Fatalf("Unexpected builds: %#v", builds)
+	}
+	_, missingErr := client.ListBuilds("missing")
+	if nil == missingErr {
+		t.Fatal("Expected listing the builds of a missing pipeline to fail")
+	}
+}
+
+func TestATCClientTokenRefresh(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	client := newTestATCClient(atc)
+	loginErr := client.Login()
+	if nil != loginErr {
+		t.Fatal(loginErr)
+	}
+	// Expire the client's token. The 401 triggers a single login and retry.
+	atc.validToken = "rotated"
+	_, pipelinesErr := client.ListPipelines()
+	if nil != pipelinesErr {
+		t.Fatal(pipelinesErr)
+	}
+	if atc.logins != 2 || client.token != "token-2" {
+		t.Fatalf("Expected the token to be refreshed: %d logins, token %s", atc.logins, client.token)
+	}
+}
+
+func TestATCClientPathEscape(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+
+	client := newTestATCClient(atc)
+	loginErr := client.Login()
+	if nil != loginErr {
+		t.Fatal(loginErr)
+	}
+	// The fake ATC returns a 404 for these, so only the paths are checked
+	testCases := []struct {
+		request      func() error
+		expectedPath string
+	}{
+		{
+			func() error {
+				_, buildsErr := client.ListBuilds("release 1+2")
+				return buildsErr
+			},
+			"GET /api/v1/teams/main/pipelines/release 1+2/builds",
+		},
+		{
+			func() error {
+				return client.DestroyPipeline("release?1")
+			},
+			"DELETE /api/v1/teams/main/pipelines/release?1",
+		},
+		{
+			func() error {
+				_, buildErr := client.CreateJobBuild("release 1+2", "unit tests")
+				return buildErr
+			},
+			"POST /api/v1/teams/main/pipelines/release 1+2/jobs/unit tests/builds",
+		},
+	}
+	for _, eachCase := range testCases {
+		atc.requests = nil
+		requestErr := eachCase.request()
+		if nil == requestErr {
+			t.Fatalf("Expected %s to fail", eachCase.expectedPath)
+		}
+		if len(atc.requests) != 1 || atc.requests[0] != eachCase.expectedPath {
+			t.Fatalf("Expected %s, got %v", eachCase.expectedPath, atc.requests)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package concourse
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Control plane POST actions
+const (
+	ControlPlaneActionSync  = "sync"
+	ControlPlaneActionBuild = "build"
+)
+
+// ControlPlaneRequest is an API request to the control plane
+type ControlPlaneRequest struct {
+	Method  string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Return the header value using a case insensitive match
+func (request *ControlPlaneRequest) header(name string) string {
+	for eachName, eachValue := range request.Headers {
+		if strings.EqualFold(eachName, name) {
+			return eachValue
+		}
+	}
+	return ""
+}
+
+// controlPlaneAction is the POST body
+type controlPlaneAction struct {
+	Action   string `json:"action"`
+	Pipeline string `json:"pipeline"`
+	Job      string `json:"job"`
+}
+
+// ControlPlanePipeline is a pipeline's state as reported by the ATC
+type ControlPlanePipeline struct {
+	Name        string `json:"name"`
+	Paused      bool   `json:"paused"`
+	Public      bool   `json:"public"`
+	LatestBuild *Build `json:"latestBuild,omitempty"`
+}
+
+// ControlPlaneStatus is the GET response
+type ControlPlaneStatus struct {
+	ConcourseURL string                 `json:"concourseURL"`
+	Version      string                 `json:"version"`
+	LastSync     *SyncStatus            `json:"lastSync"`
+	Pipelines    []ControlPlanePipeline `json:"pipelines"`
+	// ATCError is set if the pipelines couldn't be listed
+	ATCError string `json:"atcError,omitempty"`
+}
+
+// ControlPlane reports the Concourse and sync state, and triggers syncs and
+// job builds. The ATC is located via the most recent sync status.
+type ControlPlane struct {
+	Status   StatusStore
+	Username string
+	Password string
+	// APIToken authenticates POST requests as a bearer token. POSTs are
+	// rejected if it's empty.
+	APIToken string
+}
+
+// Return a JSON error response body
+func controlPlaneError(format string, args ...interface{}) map[string]string {
+	return map[string]string{
+		"error": fmt.Sprintf(format, args...),
+	}
+}
+
+// Return an ATC client for the Concourse that published the status
+func (plane *ControlPlane) atcClient(status *SyncStatus) *ATCClient {
+	return NewATCClient(status.ConcourseURL,
+		firstNonEmpty(status.TeamName, defaultTeamName),
+		plane.Username,
+		plane.Password)
+}
+
+// Return the ATC pipeline states
+func (plane *ControlPlane) pipelines(status *SyncStatus) ([]ControlPlanePipeline, error) {
+	atcClient := plane.atcClient(status)
+	atcPipelines, atcPipelinesErr := atcClient.ListPipelines()
+	if nil != atcPipelinesErr {
+		return nil, atcPipelinesErr
+	}
+	pipelines := []ControlPlanePipeline{}
+	for _, eachPipeline := range atcPipelines {
+		pipeline := ControlPlanePipeline{
+			Name:   eachPipeline.Name,
+			Paused: eachPipeline.Paused,
+			Public: eachPipeline.Public,
+		}
+		// Builds are listed newest first
+		builds, buildsErr := atcClient.ListBuilds(eachPipeline.Name)
+		if nil != buildsErr {
+			return nil, buildsErr
+		}
+		if len(builds) > 0 {
+			pipeline.LatestBuild = &builds[0]
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	return pipelines, nil
+}
+
+// Handle the GET request
+func (plane *ControlPlane) getStatus() (int, interface{}) {
+	status, statusErr := plane.Status.Status()
+	if nil != statusErr {
+		return http.StatusBadGateway, controlPlaneError("Failed to read sync status: %s", statusErr)
+	}
+	response := &ControlPlaneStatus{
+		Version:   Version,
+		LastSync:  status,
+		Pipelines: []ControlPlanePipeline{},
+	}
+	if nil == status {
+		response.ATCError = "No sync has completed"
+		return http.StatusOK, response
+	}
+	response.ConcourseURL = status.ConcourseURL
+	pipelines, pipelinesErr := plane.pipelines(status)
+	if nil != pipelinesErr {
+		response.ATCError = pipelinesErr.Error()
+	} else {
+		response.Pipelines = pipelines
+	}
+	return http.StatusOK, response
+}
+
+// Returns true if the request has the API token
+func (plane *ControlPlane) authorized(request *ControlPlaneRequest) bool {
+	if "" == plane.APIToken {
+		return false
+	}
+	token := strings.TrimPrefix(request.header("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(plane.APIToken)) == 1
+}
+
+// Handle the POST request
+func (plane *ControlPlane) postAction(request *ControlPlaneRequest) (int, interface{}) {
+	var action controlPlaneAction
+	decodeErr := json.Unmarshal(request.Body, &action)
+	if nil != decodeErr {
+		return http.StatusBadRequest, controlPlaneError("Invalid request body: %s", decodeErr)
+	}
+	switch action.Action {
+	case ControlPlaneActionSync:
+		requestErr := plane.Status.RequestSync("control plane")
+		if nil != requestErr {
+			return http.StatusBadGateway, controlPlaneError("Failed to request sync: %s", requestErr)
+		}
+		return http.StatusAccepted, map[string]string{
+			"action": action.Action,
+		}
+	case ControlPlaneActionBuild:
+		if "" == action.Pipeline || "" == action.Job {
+			return http.StatusBadRequest, controlPlaneError("The build action requires a pipeline and job")
+		}
+		status, statusErr := plane.Status.Status()
+		if nil != statusErr {
+			return http.StatusBadGateway, controlPlaneError("Failed to read sync status: %s", statusErr)
+		}
+		if nil == status {
+			return http.StatusServiceUnavailable, controlPlaneError("No sync has completed")
+		}
+		build, buildErr := plane.atcClient(status).CreateJobBuild(action.Pipeline, action.Job)
+		if nil != buildErr {
+			return http.StatusBadGateway, controlPlaneError("Failed to trigger build: %s", buildErr)
+		}
+		return http.StatusCreated, build
+	default:
+		return http.StatusBadRequest, controlPlaneError("Unsupported action: %s", action.Action)
+	}
+}
+
+// Handle returns the HTTP status code and JSON response body for the request.
+// Both GET and POST requests require the API token.
+func (plane *ControlPlane) Handle(request *ControlPlaneRequest) (int, interface{}) {
+	method := strings.ToUpper(request.Method)
+	if "GET" != method && "POST" != method {
+		return http.StatusMethodNotAllowed, controlPlaneError("Method not allowed: %s", request.Method)
+	}
+	if !plane.authorized(request) {
+		return http.StatusUnauthorized, controlPlaneError("Unauthorized")
+	}
+	if "GET" == method {
+		return plane.getStatus()
+	}
+	return plane.postAction(request)
+}
@@ -0,0 +1,225 @@
+package concourse
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// fakeStatusStore is an in-memory StatusStore
+type fakeStatusStore struct {
+	status       *SyncStatus
+	statusErr    error
+	syncRequests []string
+}
+
+func (store *fakeStatusStore) PutStatus(status *SyncStatus) error {
+	store.status = status
+	return nil
+}
+
+func (store *fakeStatusStore) Status() (*SyncStatus, error) {
+	return store.status, store.statusErr
+}
+
+func (store *fakeStatusStore) RequestSync(reason string) error {
+	store.syncRequests = append(store.syncRequests, reason)
+	return nil
+}
+
+func (store *fakeStatusStore) SyncRequest() (string, error) {
+	if len(store.syncRequests) <= 0 {
+		return "", nil
+	}
+	return store.syncRequests[len(store.syncRequests)-1], nil
+}
+
+const testAPIToken = "make-it-so"
+
+// Return a control plane for the ATC that published a sync status
+func newTestControlPlane(atc *fakeATC) (*ControlPlane, *fakeStatusStore) {
+	store := &fakeStatusStore{
+		status: &SyncStatus{
+			ConcourseURL: atc.server.URL,
+			TeamName:     defaultTeamName,
+			Version:      "1.2.3",
+		},
+	}
+	return &ControlPlane{
+		Status:   store,
+		Username: testUsername,
+		Password: testPassword,
+		APIToken: testAPIToken,
+	}, store
+}
+
+// Return an authorized request
+func newTestControlPlaneRequest(method string, body string) *ControlPlaneRequest {
+	return &ControlPlaneRequest{
+		Method: method,
+		Headers: map[string]string{
+			"authorization": "Bearer " + testAPIToken,
+		},
+		Body: []byte(body),
+	}
+}
+
+// Return an authorized POST request
+func newTestControlPlanePost(body string) *ControlPlaneRequest {
+	return newTestControlPlaneRequest("POST", body)
+}
+
+func TestControlPlaneGet(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	atc.pipelines = []Pipeline{
+		{Name: "existing", TeamName: defaultTeamName},
+	}
+	atc.builds["existing"] = []Build{
+		{ID: 42, Name: "3", Status: "succeeded", JobName: "build", PipelineName: "existing"},
+		{ID: 41, Name: "2", Status: "failed", JobName: "build", PipelineName: "existing"},
+	}
+	plane, _ := newTestControlPlane(atc)
+
+	statusCode, response := plane.Handle(newTestControlPlaneRequest("GET", ""))
+	if statusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", statusCode)
+	}
+	status, statusOk := response.(*ControlPlaneStatus)
+	if !statusOk {
+		t.Fatalf("Unexpected response: %#v", response)
+	}
+	if status.ConcourseURL != atc.server.URL || status.LastSync.Version != "1.2.3" || "" != status.ATCError {
+		t.Fatalf("Unexpected status: %#v", status)
+	}
+	if len(status.Pipelines) != 1 || nil == status.Pipelines[0].LatestBuild || status.Pipelines[0].LatestBuild.ID != 42 {
+		t.Fatalf("Unexpected pipelines: %#v", status.Pipelines)
+	}
+}
+
+func TestControlPlaneGetWithoutSync(t *testing.T) {
+	plane := &ControlPlane{Status: &fakeStatusStore{}, APIToken: testAPIToken}
+	statusCode, response := plane.Handle(newTestControlPlaneRequest("get", ""))
+	status, statusOk := response.(*ControlPlaneStatus)
+	if statusCode != http.StatusOK || !statusOk || "" == status.ATCError || len(status.Pipelines) != 0 {
+		t.Fatalf("Unexpected response: %d %#v", statusCode, response)
+	}
+
+	plane.Status = &fakeStatusStore{statusErr: fmt.Errorf("throttled")}
+	statusCode, _ = plane.Handle(newTestControlPlaneRequest("GET", ""))
+	if statusCode != http.StatusBadGateway {
+		t.Fatalf("Unexpected status code: %d", statusCode)
+	}
+}
+
+func TestControlPlaneUnauthorized(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	plane, store := newTestControlPlane(atc)
+
+	body := []byte(`{"action":"sync"}`)
+	unauthorizedRequests := []*ControlPlaneRequest{
+		{Method: "GET"},
+		{Method: "GET", Headers: map[string]string{"Authorization": "Bearer engage"}},
+		{Method: "POST", Body: body},
+		{Method: "POST", Headers: map[string]string{"Authorization": "Bearer engage"}, Body: body},
+		{Method: "POST", Headers: map[string]string{"Authorization": testAPIToken + "-suffix"}, Body: body},
+	}
+	for _, eachRequest := range unauthorizedRequests {
+		statusCode, _ := plane.Handle(eachRequest)
+		if statusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected %s %#v to be unauthorized, got %d",
+				eachRequest.Method,
+				eachRequest.Headers,
+				statusCode)
+		}
+	}
+
+	// Requests are rejected if the token isn't configured
+	plane.APIToken = ""
+	for _, eachMethod := range []string{"GET", "POST"} {
+		statusCode, _ := plane.Handle(&ControlPlaneRequest{
+			Method:  eachMethod,
+			Headers: map[string]string{"Authorization": "Bearer "},
+			Body:    body,
+		})
+		if statusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected an empty token to be unauthorized for %s, got %d", eachMethod, statusCode)
+		}
+	}
+	if len(store.syncRequests) != 0 {
+		t.Fatalf("Unexpected sync requests: %v", store.syncRequests)
+	}
+}
+
+func TestControlPlaneSyncAction(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	plane, store := newTestControlPlane(atc)
+
+	statusCode, _ := plane.Handle(newTestControlPlanePost(`{"action":"sync"}`))
+	if statusCode != http.StatusAccepted {
+		t.Fatalf("Unexpected status code: %d", statusCode)
+	}
+	if len(store.syncRequests) != 1 {
+		t.Fatalf("Expected a sync request, got %v", store.syncRequests)
+	}
+}
+
+func TestControlPlaneBuildAction(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	plane, _ := newTestControlPlane(atc)
+
+	statusCode, response := plane.Handle(newTestControlPlanePost(`{"action":"build","pipeline":"existing","job":"build"}`))
+	if statusCode != http.StatusCreated {
+		t.Fatalf("Unexpected status code: %d %#v", statusCode, response)
+	}
+	build, buildOk := response.(*Build)
+	if !buildOk || build.ID != 43 || build.JobName != "build" {
+		t.Fatalf("Unexpected build: %#v", response)
+	}
+	lastRequest := atc.requests[len(atc.requests)-1]
+	if lastRequest != "POST /api/v1/teams/main/pipelines/existing/jobs/build/builds" {
+		t.Fatalf("Unexpected request: %s", lastRequest)
+	}
+
+	// The job must exist
+	statusCode, _ = plane.Handle(newTestControlPlanePost(`{"action":"build","pipeline":"existing","job":"missing"}`))
+	if statusCode != http.StatusBadGateway {
+		t.Fatalf("Unexpected status code for a missing job: %d", statusCode)
+	}
+}
+
+func TestControlPlaneInvalidRequests(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	plane, store := newTestControlPlane(atc)
+
+	testCases := []struct {
+		request    *ControlPlaneRequest
+		statusCode int
+	}{
+		{newTestControlPlanePost(`{"action":`), http.StatusBadRequest},
+		{newTestControlPlanePost(`{"action":"destroy"}`), http.StatusBadRequest},
+		{newTestControlPlanePost(`{"action":"build","pipeline":"existing"}`), http.StatusBadRequest},
+		{&ControlPlaneRequest{Method: "DELETE"}, http.StatusMethodNotAllowed},
+	}
+	for _, eachCase := range testCases {
+		statusCode, _ := plane.Handle(eachCase.request)
+		if statusCode != eachCase.statusCode {
+			t.Fatalf("Expected %d for %s %s, got %d",
+				eachCase.statusCode,
+				eachCase.request.Method,
+				string(eachCase.request.Body),
+				statusCode)
+		}
+	}
+
+	// Builds can't be triggered until a sync publishes the ATC URL
+	store.status = nil
+	statusCode, _ := plane.Handle(newTestControlPlanePost(`{"action":"build","pipeline":"existing","job":"build"}`))
+	if statusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Unexpected status code without a sync: %d", statusCode)
+	}
+}
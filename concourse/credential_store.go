@@ -0,0 +1,197 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the credential stores
+const (
+	CredentialStoreInline = "inline"
+	CredentialStoreVault  = "vault"
+	CredentialStoreSSM    = "ssm"
+	// CredentialStoreFile is the previous name of the inline store
+	CredentialStoreFile = "file"
+)
+
+const (
+	defaultCredentialStore      = CredentialStoreInline
+	defaultCredentialPathPrefix = "/concourse"
+)
+
+// credentialStore saves the pipeline credential vars
+type credentialStore interface {
+	// Save the vars
+	store(vars map[string]interface{}) error
+	// Remove any local copy of the vars once the pipelines are set
+	cleanup() error
+	// Returns true if the vars must be interpolated into the pipeline
+	// config rather than resolved by a Concourse credential manager
+	inline() bool
+}
+
+// Return the sorted var names
+func sortedVarNames(vars map[string]interface{}) []string {
+	var names []string
+	for eachName := range vars {
+		names = append(names, eachName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Inline
+
+// inlineCredentialStore interpolates the vars into the pipeline config, as
+// with fly set-pipeline -l. The vars are only held in memory.
+type inlineCredentialStore struct {
+}
+
+func (inlineStore *inlineCredentialStore) store(vars map[string]interface{}) error {
+	return nil
+}
+
+func (inlineStore *inlineCredentialStore) cleanup() error {
+	return nil
+}
+
+func (inlineStore *inlineCredentialStore) inline() bool {
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Vault
+
+// vaultCredentialStore writes each var to the Vault KV path that the
+// Concourse Vault credential manager reads for team scoped ((vars)). It's
+// only supported for an externally managed Concourse whose web node is
+// started with the --vault-* flags.
+// Ref: https://concourse-ci.org/vault-credential-manager.html
+type vaultCredentialStore struct {
+	address    string
+	token      string
+	pathPrefix string
+	teamName   string
+	httpClient *http.Client
+}
+
+func (vaultStore *vaultCredentialStore) store(vars map[string]interface{}) error {
+	if "" == vaultStore.address || "" == vaultStore.token {
+		return fmt.Errorf("A Vault address and token are required for the vault credential store")
+	}
+	for _, eachName := range sortedVarNames(vars) {
+		body, bodyErr := json.Marshal(map[string]interface{}{
+			"value": vars[eachName],
+		})
+		if nil != bodyErr {
+			return bodyErr
+		}
+		secretPath := path.Join("/v1", vaultStore.pathPrefix, vaultStore.teamName, eachName)
+		httpReq, httpReqErr := http.NewRequest("POST",
+			strings.TrimSuffix(vaultStore.address, "/")+secretPath,
+			bytes.NewReader(body))
+		if nil != httpReqErr {
+			return httpReqErr
+		}
+		httpReq.Header.Set("X-Vault-Token", vaultStore.token)
+		httpReq.Header.Set("Content-Type", "application/json")
+		response, responseErr := vaultStore.httpClient.Do(httpReq)
+		if nil != responseErr {
+			return responseErr
+		}
+		response.Body.Close()
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("Failed to write Vault secret %s: %s", secretPath, response.Status)
+		}
+	}
+	return nil
+}
+
+func (vaultStore *vaultCredentialStore) cleanup() error {
+	return nil
+}
+
+func (vaultStore *vaultCredentialStore) inline() bool {
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SSM Parameter Store
+
+// ssmCredentialStore writes each var to the SSM SecureString parameter
+// that the Concourse SSM credential manager reads for team scoped ((vars)).
+// It's only supported for an externally managed Concourse whose web node
+// is started with the --aws-ssm-* flags, and requires ssm:PutParameter
+// (and kms:Encrypt for a custom key) on the parameter prefix.
+// Ref: https://concourse-ci.org/aws-ssm-credential-manager.html
+type ssmCredentialStore struct {
+	region     string
+	kmsKeyID   string
+	pathPrefix string
+	teamName   string
+}
+
+func (ssmStore *ssmCredentialStore) store(vars map[string]interface{}) error {
+	ssmSvc := ssm.New(session.New(aws.NewConfig().WithRegion(ssmStore.region)))
+	for _, eachName := range sortedVarNames(vars) {
+		params := &ssm.PutParameterInput{
+			Name:      aws.String(path.Join("/", ssmStore.pathPrefix, ssmStore.teamName, eachName)),
+			Value:     aws.String(fmt.Sprintf("%v", vars[eachName])),
+			Type:      aws.String(ssm.ParameterTypeSecureString),
+			Overwrite: aws.Bool(true),
+		}
+		if "" != ssmStore.kmsKeyID {
+			params.KeyId = aws.String(ssmStore.kmsKeyID)
+		}
+		_, putErr := ssmSvc.PutParameter(params)
+		if nil != putErr {
+			return putErr
+		}
+	}
+	return nil
+}
+
+func (ssmStore *ssmCredentialStore) cleanup() error {
+	return nil
+}
+
+func (ssmStore *ssmCredentialStore) inline() bool {
+	return false
+}
+
+// Return the credentialStore selected by the SyncOptions
+func newCredentialStore(options *SyncOptions) (credentialStore, error) {
+	switch options.CredentialStore {
+	case CredentialStoreInline, CredentialStoreFile:
+		return &inlineCredentialStore{}, nil
+	case CredentialStoreVault:
+		return &vaultCredentialStore{
+			address:    options.VaultAddress,
+			token:      options.VaultToken,
+			pathPrefix: options.CredentialPathPrefix,
+			teamName:   options.TeamName,
+			httpClient: &http.Client{
+				Timeout: 30 * time.Second,
+			},
+		}, nil
+	case CredentialStoreSSM:
+		return &ssmCredentialStore{
+			region:     options.AWSRegion,
+			kmsKeyID:   options.SSMKMSKeyID,
+			pathPrefix: options.CredentialPathPrefix,
+			teamName:   options.TeamName,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported credential store: %s", options.CredentialStore)
+	}
+}
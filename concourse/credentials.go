@@ -0,0 +1,234 @@
+package concourse
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Names of the CredentialProvider implementations
+const (
+	CredentialProviderEC2        = "ec2"
+	CredentialProviderEnv        = "env"
+	CredentialProviderShared     = "shared"
+	CredentialProviderAssumeRole = "assume-role"
+)
+
+const (
+	defaultCredentialProvider = CredentialProviderEC2
+	defaultAWSRegion          = "us-west-2"
+	defaultAWSProfile         = "default"
+	defaultRoleSessionName    = "SpartaCICD"
+)
+
+// AWSCredentials are the credentials injected into the pipelines
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expiration is the zero time for credentials that don't expire
+	Expiration time.Time
+}
+
+// CredentialProvider returns the AWS credentials that are injected
+// into the pipelines
+type CredentialProvider interface {
+	Retrieve() (*AWSCredentials, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Environment
+
+// EnvironmentProvider returns the credentials defined by the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables
+type EnvironmentProvider struct {
+}
+
+// Retrieve returns the environment credentials
+func (provider *EnvironmentProvider) Retrieve() (*AWSCredentials, error) {
+	creds := &AWSCredentials{
+		AccessKeyID:     firstNonEmpty(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_ACCESS_KEY")),
+		SecretAccessKey: firstNonEmpty(os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SECRET_KEY")),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if "" == creds.AccessKeyID || "" == creds.SecretAccessKey {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return creds, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Shared credentials file
+
+// SharedCredentialsProvider returns the credentials for a profile in the
+// shared credentials file
+// Ref: http://docs.aws.amazon.com/cli/latest/userguide/cli-config-files.html
+type SharedCredentialsProvider struct {
+	// Filename defaults to $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+	Filename string
+	// Profile defaults to $AWS_PROFILE or default
+	Profile string
+}
+
+// Retrieve returns the profile's credentials
+func (provider *SharedCredentialsProvider) Retrieve() (*AWSCredentials, error) {
+	filename := firstNonEmpty(provider.Filename,
+		os.Getenv("AWS_SHARED_CREDENTIALS_FILE"),
+		filepath.Join(os.Getenv("HOME"), ".aws", "credentials"))
+	profile := firstNonEmpty(provider.Profile, os.Getenv("AWS_PROFILE"), defaultAWSProfile)
+
+	credsFile, credsFileErr := os.Open(filename)
+	if nil != credsFileErr {
+		return nil, credsFileErr
+	}
+	defer credsFile.Close()
+
+	profileValues := make(map[string]string)
+	inProfile := false
+	scanner := bufio.NewScanner(credsFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		keyValue := strings.SplitN(line, "=", 2)
+		if inProfile && len(keyValue) == 2 {
+			profileValues[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+	}
+	if scanErr := scanner.Err(); nil != scanErr {
+		return nil, scanErr
+	}
+	creds := &AWSCredentials{
+		AccessKeyID:     profileValues["aws_access_key_id"],
+		SecretAccessKey: profileValues["aws_secret_access_key"],
+		SessionToken:    profileValues["aws_session_token"],
+	}
+	if "" == creds.AccessKeyID || "" == creds.SecretAccessKey {
+		return nil, fmt.Errorf("Profile %s in %s doesn't define credentials", profile, filename)
+	}
+	return creds, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STS AssumeRole
+
+// AssumeRoleProvider returns temporary credentials for RoleARN, using the
+// Base provider's credentials to call STS AssumeRole. The credentials are
+// cached until RefreshMargin before they expire s.t. unchanged pipelines
+// aren't set again on every sync.
+type AssumeRoleProvider struct {
+	Base            CredentialProvider
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	Duration        time.Duration
+	Region          string
+	// Endpoint optionally overrides the STS endpoint
+	Endpoint string
+	// RefreshMargin defaults to the sync credentials refresh margin
+	RefreshMargin time.Duration
+	creds         *AWSCredentials
+}
+
+// Retrieve returns the assumed role's credentials
+func (provider *AssumeRoleProvider) Retrieve() (*AWSCredentials, error) {
+	if "" == provider.RoleARN {
+		return nil, fmt.Errorf("A role ARN is required to assume a role")
+	}
+	refreshMargin := provider.RefreshMargin
+	if refreshMargin <= 0 {
+		refreshMargin = defaultCredentialsMargin
+	}
+	if nil != provider.creds &&
+		time.Now().Before(provider.creds.Expiration.Add(-refreshMargin)) {
+		cachedCreds := *provider.creds
+		return &cachedCreds, nil
+	}
+	baseCreds, baseCredsErr := provider.Base.Retrieve()
+	if nil != baseCredsErr {
+		return nil, baseCredsErr
+	}
+	awsConfig := aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(baseCreds.AccessKeyID,
+			baseCreds.SecretAccessKey,
+			baseCreds.SessionToken)).
+		WithRegion(firstNonEmpty(provider.Region, defaultAWSRegion))
+	if "" != provider.Endpoint {
+		awsConfig = awsConfig.WithEndpoint(provider.Endpoint)
+	}
+	params := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(provider.RoleARN),
+		RoleSessionName: aws.String(firstNonEmpty(provider.RoleSessionName, defaultRoleSessionName)),
+	}
+	if "" != provider.ExternalID {
+		params.ExternalId = aws.String(provider.ExternalID)
+	}
+	if provider.Duration > 0 {
+		params.DurationSeconds = aws.Int64(int64(provider.Duration / time.Second))
+	}
+	stsSvc := sts.New(session.New(awsConfig))
+	assumeRoleOutput, assumeRoleOutputErr := stsSvc.AssumeRole(params)
+	if nil != assumeRoleOutputErr {
+		return nil, assumeRoleOutputErr
+	}
+	creds := &AWSCredentials{
+		AccessKeyID:     aws.StringValue(assumeRoleOutput.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(assumeRoleOutput.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(assumeRoleOutput.Credentials.SessionToken),
+	}
+	if nil != assumeRoleOutput.Credentials.Expiration {
+		creds.Expiration = *assumeRoleOutput.Credentials.Expiration
+	}
+	cachedCreds := *creds
+	provider.creds = &cachedCreds
+	return creds, nil
+}
+
+// Return the named CredentialProvider, excluding AssumeRole
+func newBaseCredentialProvider(name string, options *SyncOptions) (CredentialProvider, error) {
+	switch name {
+	case CredentialProviderEC2:
+		return NewEC2MetadataProvider(options.MetadataURL, options.AllowIMDSv1), nil
+	case CredentialProviderEnv:
+		return &EnvironmentProvider{}, nil
+	case CredentialProviderShared:
+		return &SharedCredentialsProvider{
+			Filename: options.SharedCredentialsFile,
+			Profile:  options.SharedCredentialsProfile,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported credential provider: %s", name)
+	}
+}
+
+// NewCredentialProvider returns the CredentialProvider selected by the
+// SyncOptions
+func NewCredentialProvider(options *SyncOptions) (CredentialProvider, error) {
+	if options.CredentialProvider != CredentialProviderAssumeRole {
+		return newBaseCredentialProvider(options.CredentialProvider, options)
+	}
+	baseProvider, baseProviderErr := newBaseCredentialProvider(options.AssumeRoleBaseProvider, options)
+	if nil != baseProviderErr {
+		return nil, baseProviderErr
+	}
+	return &AssumeRoleProvider{
+		Base:          baseProvider,
+		RoleARN:       options.AssumeRoleARN,
+		ExternalID:    options.AssumeRoleExternalID,
+		Region:        options.AWSRegion,
+		RefreshMargin: options.CredentialsRefreshMargin,
+	}, nil
+}
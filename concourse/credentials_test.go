@@ -0,0 +1,205 @@
+package concourse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Set the environment variables and return a func that restores them
+func setTestEnv(values map[string]string) func() {
+	previous := make(map[string]*string)
+	for eachName, eachValue := range values {
+		if existing, exists := os.LookupEnv(eachName); exists {
+			previous[eachName] = &existing
+		} else {
+			previous[eachName] = nil
+		}
+		if "" == eachValue {
+			os.Unsetenv(eachName)
+		} else {
+			os.Setenv(eachName, eachValue)
+		}
+	}
+	return func() {
+		for eachName, eachValue := range previous {
+			if nil == eachValue {
+				os.Unsetenv(eachName)
+			} else {
+				os.Setenv(eachName, *eachValue)
+			}
+		}
+	}
+}
+
+func TestEnvironmentProvider(t *testing.T) {
+	restore := setTestEnv(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "SECRET",
+		"AWS_SESSION_TOKEN":     "TOKEN",
+	})
+	defer restore()
+
+	creds, credsErr := (&EnvironmentProvider{}).Retrieve()
+	if nil != credsErr {
+		t.Fatal(credsErr)
+	}
+	if creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "SECRET" || creds.SessionToken != "TOKEN" {
+		t.Fatalf("Unexpected credentials: %#v", creds)
+	}
+
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	_, missingErr := (&EnvironmentProvider{}).Retrieve()
+	if nil == missingErr {
+		t.Fatal("Expected missing environment credentials to fail")
+	}
+}
+
+func TestSharedCredentialsProvider(t *testing.T) {
+	credsDir, credsDirErr := ioutil.TempDir("", "SpartaCICDTest")
+	if nil != credsDirErr {
+		t.Fatal(credsDirErr)
+	}
+	defer os.RemoveAll(credsDir)
+	credsPath := filepath.Join(credsDir, "credentials")
+	writeErr := ioutil.WriteFile(credsPath, []byte(`# comment
+[default]
+aws_access_key_id = DEFAULTID
+aws_secret_access_key = DEFAULTSECRET
+
+[ci]
+aws_access_key_id=CIID
+aws_secret_access_key=CISECRET
+aws_session_token=CITOKEN
+`), 0600)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+	restore := setTestEnv(map[string]string{
+		"AWS_PROFILE": "",
+	})
+	defer restore()
+
+	testCases := []struct {
+		profile     string
+		accessKeyID string
+		token       string
+	}{
+		{"", "DEFAULTID", ""},
+		{"ci", "CIID", "CITOKEN"},
+	}
+	for _, eachCase := range testCases {
+		provider := &SharedCredentialsProvider{
+			Filename: credsPath,
+			Profile:  eachCase.profile,
+		}
+		creds, credsErr := provider.Retrieve()
+		if nil != credsErr {
+			t.Fatal(credsErr)
+		}
+		if creds.AccessKeyID != eachCase.accessKeyID || creds.SessionToken != eachCase.token {
+			t.Fatalf("Unexpected credentials for profile %q: %#v", eachCase.profile, creds)
+		}
+	}
+	_, missingErr := (&SharedCredentialsProvider{
+		Filename: credsPath,
+		Profile:  "missing",
+	}).Retrieve()
+	if nil == missingErr {
+		t.Fatal("Expected a missing profile to fail")
+	}
+}
+
+// Return a fake STS endpoint that issues credentials expiring after lifetime
+func newFakeSTS(lifetime time.Duration, assumeRoleCalls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("Action") != "AssumeRole" || req.Form.Get("RoleArn") != "arn:aws:iam::123456789012:role/deploy" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*assumeRoleCalls++
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASSUMED%d</AccessKeyId>
+      <SecretAccessKey>SECRET</SecretAccessKey>
+      <SessionToken>TOKEN</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+  <ResponseMetadata>
+    <RequestId>c6104cbe-af31-11e0-8154-cbc7ccf896c7</RequestId>
+  </ResponseMetadata>
+</AssumeRoleResponse>`, *assumeRoleCalls, time.Now().Add(lifetime).UTC().Format(time.RFC3339))
+	}))
+}
+
+func TestAssumeRoleProvider(t *testing.T) {
+	assumeRoleCalls := 0
+	stsServer := newFakeSTS(time.Hour, &assumeRoleCalls)
+	defer stsServer.Close()
+
+	provider := &AssumeRoleProvider{
+		Base: &staticProvider{
+			creds: AWSCredentials{
+				AccessKeyID:     "BASEID",
+				SecretAccessKey: "BASESECRET",
+			},
+		},
+		RoleARN:       "arn:aws:iam::123456789012:role/deploy",
+		Region:        "us-west-2",
+		Endpoint:      stsServer.URL,
+		RefreshMargin: 15 * time.Minute,
+	}
+	// The credentials are cached until the refresh margin
+	for i := 0; i < 2; i++ {
+		creds, credsErr := provider.Retrieve()
+		if nil != credsErr {
+			t.Fatal(credsErr)
+		}
+		if creds.AccessKeyID != "ASSUMED1" || creds.Expiration.IsZero() {
+			t.Fatalf("Unexpected credentials: %#v", creds)
+		}
+	}
+	if assumeRoleCalls != 1 {
+		t.Fatalf("Expected 1 AssumeRole call, got %d", assumeRoleCalls)
+	}
+}
+
+func TestAssumeRoleProviderRefresh(t *testing.T) {
+	assumeRoleCalls := 0
+	// Credentials that expire within the refresh margin aren't cached
+	stsServer := newFakeSTS(10*time.Minute, &assumeRoleCalls)
+	defer stsServer.Close()
+
+	provider := &AssumeRoleProvider{
+		Base: &staticProvider{
+			creds: AWSCredentials{
+				AccessKeyID:     "BASEID",
+				SecretAccessKey: "BASESECRET",
+			},
+		},
+		RoleARN:       "arn:aws:iam::123456789012:role/deploy",
+		Endpoint:      stsServer.URL,
+		RefreshMargin: 15 * time.Minute,
+	}
+	for i := 1; i <= 2; i++ {
+		creds, credsErr := provider.Retrieve()
+		if nil != credsErr {
+			t.Fatal(credsErr)
+		}
+		if creds.AccessKeyID != fmt.Sprintf("ASSUMED%d", i) {
+			t.Fatalf("Unexpected credentials: %#v", creds)
+		}
+	}
+	if _, err := (&AssumeRoleProvider{}).Retrieve(); nil == err {
+		t.Fatal("Expected a missing role ARN to fail")
+	}
+}
@@ -0,0 +1,165 @@
+package concourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	metadataTokenHeader    = "X-aws-ec2-metadata-token"
+	metadataTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	metadataTokenTTL       = 6 * time.Hour
+	// Tokens are renewed this long before they expire
+	metadataTokenRenewMargin = 5 * time.Minute
+)
+
+// EC2MetadataProvider returns the instance role credentials from the
+// EC2 instance metadata service using IMDSv2 session tokens. Tokens are
+// cached and renewed before they expire.
+// Ref: http://docs.aws.amazon.com/AWSEC2/latest/UserGuide/iam-roles-for-amazon-ec2.html
+// Ref: http://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
+type EC2MetadataProvider struct {
+	baseURL     string
+	allowIMDSv1 bool
+	token       string
+	tokenExpiry time.Time
+	httpClient  *http.Client
+}
+
+// NewEC2MetadataProvider returns a provider for the metadata service at
+// baseURL. If allowIMDSv1 is true, IMDSv1 requests are used when an
+// IMDSv2 token can't be obtained.
+func NewEC2MetadataProvider(baseURL string, allowIMDSv1 bool) *EC2MetadataProvider {
+	return &EC2MetadataProvider{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		allowIMDSv1: allowIMDSv1,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Return the cached IMDSv2 session token, requesting a new one if
+// needed. The empty token is returned if IMDSv1 fallback is allowed
+// and the token request fails.
+func (provider *EC2MetadataProvider) sessionToken() (string, error) {
+	if "" != provider.token && time.Now().Before(provider.tokenExpiry) {
+		return provider.token, nil
+	}
+	requestTime := time.Now()
+	token, tokenErr := provider.requestSessionToken()
+	if nil != tokenErr {
+		provider.token = ""
+		if provider.allowIMDSv1 {
+			return "", nil
+		}
+		return "", tokenErr
+	}
+	provider.token = token
+	provider.tokenExpiry = requestTime.Add(metadataTokenTTL - metadataTokenRenewMargin)
+	return token, nil
+}
+
+// Request a new IMDSv2 session token
+func (provider *EC2MetadataProvider) requestSessionToken() (string, error) {
+	httpReq, httpReqErr := http.NewRequest("PUT", provider.baseURL+"/latest/api/token", nil)
+	if nil != httpReqErr {
+		return "", httpReqErr
+	}
+	httpReq.Header.Set(metadataTokenTTLHeader,
+		fmt.Sprintf("%d", int64(metadataTokenTTL/time.Second)))
+	response, responseErr := provider.httpClient.Do(httpReq)
+	if nil != responseErr {
+		return "", responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to get IMDSv2 token: %s", response.Status)
+	}
+	token, tokenErr := ioutil.ReadAll(response.Body)
+	if nil != tokenErr {
+		return "", tokenErr
+	}
+	return string(token), nil
+}
+
+// GET a metadata path. If the cached token is rejected, a new token is
+// requested and the request retried once.
+func (provider *EC2MetadataProvider) get(metadataPath string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		token, tokenErr := provider.sessionToken()
+		if nil != tokenErr {
+			return nil, tokenErr
+		}
+		httpReq, httpReqErr := http.NewRequest("GET", provider.baseURL+metadataPath, nil)
+		if nil != httpReqErr {
+			return nil, httpReqErr
+		}
+		if "" != token {
+			httpReq.Header.Set(metadataTokenHeader, token)
+		}
+		response, responseErr := provider.httpClient.Do(httpReq)
+		if nil != responseErr {
+			return nil, responseErr
+		}
+		if response.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			response.Body.Close()
+			provider.token = ""
+			continue
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Failed to GET %s: %s", metadataPath, response.Status)
+		}
+		return ioutil.ReadAll(response.Body)
+	}
+}
+
+// Retrieve returns the instance role credentials
+func (provider *EC2MetadataProvider) Retrieve() (*AWSCredentials, error) {
+	roleContent, roleContentErr := provider.get("/latest/meta-data/iam/security-credentials/")
+	if nil != roleContentErr {
+		return nil, roleContentErr
+	}
+	roleName := strings.TrimSpace(strings.SplitN(string(roleContent), "\n", 2)[0])
+	if "" == roleName {
+		return nil, fmt.Errorf("No IAM role is associated with the instance")
+	}
+	credsContent, credsContentErr := provider.get(fmt.Sprintf("/latest/meta-data/iam/security-credentials/%s", roleName))
+	if nil != credsContentErr {
+		return nil, credsContentErr
+	}
+	var credsData struct {
+		Code            string
+		LastUpdated     string
+		Type            string
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      string
+	}
+	decodeErr := json.Unmarshal(credsContent, &credsData)
+	if nil != decodeErr {
+		return nil, decodeErr
+	}
+	if "" != credsData.Code && "Success" != credsData.Code {
+		return nil, fmt.Errorf("Instance credentials unavailable: %s", credsData.Code)
+	}
+	creds := &AWSCredentials{
+		AccessKeyID:     credsData.AccessKeyID,
+		SecretAccessKey: credsData.SecretAccessKey,
+		SessionToken:    credsData.Token,
+	}
+	if "" != credsData.Expiration {
+		expiration, expirationErr := time.Parse(time.RFC3339, credsData.Expiration)
+		if nil != expirationErr {
+			return nil, expirationErr
+		}
+		creds.Expiration = expiration
+	}
+	return creds, nil
+}
@@ -0,0 +1,150 @@
+package concourse
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeMetadataService is an httptest instance metadata service that issues
+// numbered IMDSv2 tokens
+type fakeMetadataService struct {
+	server *httptest.Server
+	// The token endpoint returns a 403 if IMDSv2 is disabled
+	imdsv2Disabled bool
+	// Requests without a token are accepted if IMDSv1 is enabled
+	imdsv1Enabled bool
+	// Number of token requests
+	tokenRequests int
+	validToken    string
+}
+
+func newFakeMetadataService() *fakeMetadataService {
+	metadata := &fakeMetadataService{}
+	metadata.server = httptest.NewServer(metadata)
+	return metadata
+}
+
+func (metadata *fakeMetadataService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "PUT" && req.URL.Path == "/latest/api/token" {
+		if metadata.imdsv2Disabled {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		metadata.tokenRequests++
+		metadata.validToken = fmt.Sprintf("imds-token-%d", metadata.tokenRequests)
+		fmt.Fprint(w, metadata.validToken)
+		return
+	}
+	token := req.Header.Get(metadataTokenHeader)
+	if ("" == token && !metadata.imdsv1Enabled) ||
+		("" != token && token != metadata.validToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch req.URL.Path {
+	case "/latest/meta-data/iam/security-credentials/":
+		fmt.Fprint(w, "ConcourseRole\n")
+	case "/latest/meta-data/iam/security-credentials/ConcourseRole":
+		fmt.Fprint(w, `{
+			"Code": "Success",
+			"AccessKeyId": "AKID",
+			"SecretAccessKey": "SECRET",
+			"Token": "TOKEN",
+			"Expiration": "2030-01-01T00:00:00Z"
+		}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Return an error if the credentials aren't the fake service's
+func checkMetadataCredentials(creds *AWSCredentials) error {
+	if creds.AccessKeyID != "AKID" || creds.SessionToken != "TOKEN" || creds.Expiration.Year() != 2030 {
+		return fmt.Errorf("Unexpected credentials: %#v", creds)
+	}
+	return nil
+}
+
+func TestEC2MetadataProvider(t *testing.T) {
+	metadata := newFakeMetadataService()
+	defer metadata.server.Close()
+
+	provider := NewEC2MetadataProvider(metadata.server.URL, false)
+	for i := 0; i < 2; i++ {
+		creds, credsErr := provider.Retrieve()
+		if nil != credsErr {
+			t.Fatal(credsErr)
+		}
+		if credsErr := checkMetadataCredentials(creds); nil != credsErr {
+			t.Fatal(credsErr)
+		}
+	}
+	// The session token is reused
+	if metadata.tokenRequests != 1 {
+		t.Fatalf("Expected 1 token request, got %d", metadata.tokenRequests)
+	}
+}
+
+func TestEC2MetadataProviderIMDSv1Fallback(t *testing.T) {
+	testCases := []struct {
+		imdsv2Disabled bool
+		imdsv1Enabled  bool
+		allowIMDSv1    bool
+		expectErr      bool
+	}{
+		// IMDSv1 is only used if the provider opts in
+		{true, true, true, false},
+		{true, true, false, true},
+		// IMDSv2 is preferred when it's available
+		{false, false, true, false},
+		{true, false, true, true},
+	}
+	for _, eachCase := range testCases {
+		metadata := newFakeMetadataService()
+		metadata.imdsv2Disabled = eachCase.imdsv2Disabled
+		metadata.imdsv1Enabled = eachCase.imdsv1Enabled
+
+		creds, credsErr := NewEC2MetadataProvider(metadata.server.URL, eachCase.allowIMDSv1).Retrieve()
+		metadata.server.Close()
+		if eachCase.expectErr {
+			if nil == credsErr {
+				t.Fatalf("Expected %#v to fail", eachCase)
+			}
+			continue
+		}
+		if nil != credsErr {
+			t.Fatalf("Unexpected error for %#v: %s", eachCase, credsErr)
+		}
+		if credsErr := checkMetadataCredentials(creds); nil != credsErr {
+			t.Fatal(credsErr)
+		}
+	}
+}
+
+func TestEC2MetadataProviderTokenRenewal(t *testing.T) {
+	metadata := newFakeMetadataService()
+	defer metadata.server.Close()
+
+	provider := NewEC2MetadataProvider(metadata.server.URL, false)
+	_, credsErr := provider.Retrieve()
+	if nil != credsErr {
+		t.Fatal(credsErr)
+	}
+	// Revoke the cached token. The 401 triggers a single token request
+	// and retry.
+	metadata.validToken = "revoked"
+	creds, credsErr := provider.Retrieve()
+	if nil != credsErr {
+		t.Fatal(credsErr)
+	}
+	if credsErr := checkMetadataCredentials(creds); nil != credsErr {
+		t.Fatal(credsErr)
+	}
+	if metadata.tokenRequests != 2 || provider.token != "imds-token-2" {
+		t.Fatalf("Expected the token to be renewed: %d token requests, token %s",
+			metadata.tokenRequests,
+			provider.token)
+	}
+}
@@ -1,42 +1,94 @@
 package concourse
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/Sirupsen/logrus"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"path"
-	"text/template"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-var credentialsTemplate = `
-s3-bucket: weagle
-aws-region: us-west-2
-s3-access-key-id: {{ .AccessKeyID }}
-s3-secret-access-key: {{ .SecretAccessKey }}`
-
 const (
-	concourseTargetName   = "sparta"
-	concoursePipelineName = "SpartaCICD"
-	ec2MetadataServer     = "http://169.254.169.254"
+	ec2MetadataServer   = "http://169.254.169.254"
+	defaultPollInterval = 5 * 60 * time.Second
+	// Retry interval used when the credentials are already within the
+	// refresh margin
+	minimumSyncInterval = 30 * time.Second
 )
 
 type workflowContext struct {
-	basicAuthUser     string
-	basicAuthPassword string
-	logger            *logrus.Logger
-	repoURL           string
-	pipelineRelPath   string
-	localCredsPath    string
-	flyCLIPath        string
-	tempRepoPath      string
+	basicAuthUser      string
+	basicAuthPassword  string
+	logger             *logrus.Logger
+	repoURL            string
+	repoBranch         string
+	pipelineRelPath    string
+	pipelineName       string
+	teamName           string
+	concourseURL       string
+	tempRepoPath       string
+	commitSHA          string
+	credentialsHash    string
+	credentialsMargin  time.Duration
+	credentialProvider CredentialProvider
+	credentialStore    credentialStore
+	awsRegion          string
+	s3Bucket           string
+	pipelineGlob       string
+	destroyRemoved     bool
+	pipelines          []pipelineDefinition
+	credentialVars     map[string]interface{}
+	atcClient          *ATCClient
+	results            []pipelineResult
+	state              *syncState
+	syncErr            error
+	// Diff the pipelines rather than setting them
+	planOnly bool
+	diffs    []PipelineDiff
+}
+
+// pipelineDefinition is a pipeline file found in the cloned repo
+type pipelineDefinition struct {
+	name string
+	path string
+}
+
+// pipelineResult is the outcome of syncing a single pipeline
+type pipelineResult struct {
+	Name      string
+	Path      string
+	Destroyed bool
+	Unchanged bool
+	Err       error
+}
+
+// appliedPipeline is the source of the most recently applied pipeline
+// config. The pipeline is only set again when one of these changes.
+type appliedPipeline struct {
+	commitSHA       string
+	configHash      string
+	credentialsHash string
+}
+
+// syncState is the state preserved across SyncIt iterations
+type syncState struct {
+	appliedPipelines map[string]appliedPipeline
+	credentialsHash  string
+	// Expiration of the most recently retrieved credentials. It's kept
+	// s.t. a sync that fails before refreshing them still schedules the
+	// next sync before they expire.
+	credentialsExpiry time.Time
 }
+
+// syncStep is a step in the sync workflow. A step that returns an error
+// along with the next step has failed, but the remaining steps still run.
 type syncStep func(ctx *workflowContext) (syncStep, error)
 
 // Utility method to run shell command
@@ -62,165 +114,474 @@ func cloneRepo(ctx *workflowContext) (syncStep, error) {
 	ctx.tempRepoPath = tempDir
 
 	// Clone the repo
-	cmd := exec.Command("git", "clone", "--depth", "1", ctx.repoURL, ctx.tempRepoPath)
-	return refreshCredentials, runOSCommand(cmd, ctx.logger)
+	cmd := exec.Command("git",
+		"clone",
+		"--depth",
+		"1",
+		"--branch",
+		ctx.repoBranch,
+		ctx.repoURL,
+		ctx.tempRepoPath)
+	cloneErr := runOSCommand(cmd, ctx.logger)
+	if nil != cloneErr {
+		return nil, cloneErr
+	}
+	// Record the commit s.t. unchanged pipelines can be skipped
+	revParse := exec.Command("git", "rev-parse", "HEAD")
+	revParse.Dir = ctx.tempRepoPath
+	revParseOutput, revParseErr := revParse.Output()
+	if nil != revParseErr {
+		return nil, revParseErr
+	}
+	ctx.commitSHA = strings.TrimSpace(string(revParseOutput))
+	return discoverPipelines, nil
+}
+
+// Return the hex encoded SHA256 hash of the input
+func contentHash(input []byte) string {
+	hash := sha256.Sum256(input)
+	return hex.EncodeToString(hash[:])
+}
+
+// Find the pipeline definitions in the cloned repo. If there's no
+// glob the single pipelineRelPath file is used.
+func discoverPipelines(ctx *workflowContext) (syncStep, error) {
+	if "" == ctx.pipelineGlob {
+		ctx.pipelines = []pipelineDefinition{
+			{
+				name: ctx.pipelineName,
+				path: path.Join(ctx.tempRepoPath, ctx.pipelineRelPath),
+			},
+		}
+		return refreshCredentials, nil
+	}
+	matches, matchesErr := filepath.Glob(filepath.Join(ctx.tempRepoPath, ctx.pipelineGlob))
+	if nil != matchesErr {
+		return nil, matchesErr
+	}
+	// Pipelines are named after the file, so files with the same name in
+	// different directories would overwrite each other
+	matchPaths := make(map[string]string)
+	for _, eachMatch := range matches {
+		baseName := filepath.Base(eachMatch)
+		pipelineName := strings.TrimSuffix(baseName, filepath.Ext(baseName))
+		if existingPath, exists := matchPaths[pipelineName]; exists {
+			return nil, fmt.Errorf("Pipeline files %s and %s are both named %s",
+				existingPath,
+				eachMatch,
+				pipelineName)
+		}
+		matchPaths[pipelineName] = eachMatch
+		ctx.pipelines = append(ctx.pipelines, pipelineDefinition{
+			name: pipelineName,
+			path: eachMatch,
+		})
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Glob":      ctx.pipelineGlob,
+		"Pipelines": len(ctx.pipelines),
+	}).Info("Discovered pipelines")
+	return refreshCredentials, nil
 }
 
 func refreshCredentials(ctx *workflowContext) (syncStep, error) {
-	roleResponse, roleResponseErr := http.Get(fmt.Sprintf("%s/latest/meta-data/iam/security-credentials/", ec2MetadataServer))
-	if roleResponseErr != nil {
-		return nil, roleResponseErr
+	creds, credsErr := ctx.credentialProvider.Retrieve()
+	if nil != credsErr {
+		return nil, credsErr
 	}
-	defer roleResponse.Body.Close()
-	roleContent, roleContentErr := ioutil.ReadAll(roleResponse.Body)
-	if nil != roleContentErr {
-		return nil, roleContentErr
+	if !creds.Expiration.IsZero() {
+		ctx.state.credentialsExpiry = creds.Expiration
+	}
+	// Get the credentials, unmarshal them, and stuff them into the region...
+	// Instance role and assumed role credentials are temporary, so the
+	// session token is required as well. The keys match the ((...))
+	// placeholders in pipeline.yml.
+	ctx.credentialVars = map[string]interface{}{
+		"aws-region":        ctx.awsRegion,
+		"access-key-id":     creds.AccessKeyID,
+		"secret-access-key": creds.SecretAccessKey,
+		"session-token":     creds.SessionToken,
 	}
-	roleName := string(roleContent)
+	// Pipelines that use the var fail to render if there's no bucket
+	if "" != ctx.s3Bucket {
+		ctx.credentialVars["s3-bucket"] = ctx.s3Bucket
+	}
+	varsJSON, varsJSONErr := json.Marshal(ctx.credentialVars)
+	if nil != varsJSONErr {
+		return nil, varsJSONErr
+	}
+	ctx.credentialsHash = contentHash(varsJSON)
 
-	// Writer the body to file
-	credsResponse, credsResponseErr := http.Get(fmt.Sprintf("%s/latest/meta-data/iam/security-credentials/%s", ec2MetadataServer, roleName))
-	if nil != credsResponseErr {
-		return nil, credsResponseErr
+	if ctx.planOnly {
+		return planPipelines, nil
 	}
-	var credsData struct {
-		Code            string
-		LastUpdated     string
-		Type            string
-		AccessKeyID     string
-		SecretAccessKey string
-		Token           string
-		Expiration      string
+	// Credential managers only need to be updated when the vars change
+	if ctx.credentialsHash != ctx.state.credentialsHash {
+		storeErr := ctx.credentialStore.store(ctx.credentialVars)
+		if nil != storeErr {
+			return nil, storeErr
+		}
+		ctx.state.credentialsHash = ctx.credentialsHash
 	}
-	defer credsResponse.Body.Close()
+	return refreshPipeline, nil
+}
 
-	decodeErr := json.NewDecoder(credsResponse.Body).Decode(&credsData)
-	if nil != decodeErr {
-		return nil, decodeErr
+func refreshPipeline(ctx *workflowContext) (syncStep, error) {
+	ctx.atcClient = NewATCClient(ctx.concourseURL,
+		ctx.teamName,
+		ctx.basicAuthUser,
+		ctx.basicAuthPassword)
+	loginErr := ctx.atcClient.Login()
+	if nil != loginErr {
+		return nil, loginErr
 	}
-	// Get the credentials, unmarshal them, and stuff them into the region...
-	template, templateErr := template.New("credentials").Parse(credentialsTemplate)
-	if nil != templateErr {
-		return nil, templateErr
+
+	// Configure & unpause each pipeline. A failure for one pipeline
+	// doesn't prevent the others from being updated.
+	failedCount := 0
+	for _, eachPipeline := range ctx.pipelines {
+		result := pipelineResult{
+			Name: eachPipeline.name,
+			Path: eachPipeline.path,
+		}
+		result.Unchanged, result.Err = setPipeline(ctx, eachPipeline)
+		if nil != result.Err {
+			failedCount++
+		}
+		ctx.results = append(ctx.results, result)
 	}
-	output := &bytes.Buffer{}
-	executeErr := template.Execute(output, credsData)
-	if nil != executeErr {
-		return nil, fmt.Errorf("Failed to execute template: %s", executeErr.Error())
+	if failedCount != 0 {
+		return destroyRemovedPipelines, fmt.Errorf("Failed to update %d of %d pipelines",
+			failedCount,
+			len(ctx.pipelines))
 	}
-	return refreshPipeline, ioutil.WriteFile(ctx.localCredsPath, output.Bytes(), 0644)
+	return destroyRemovedPipelines, nil
 }
 
-func refreshPipeline(ctx *workflowContext) (syncStep, error) {
-	// Download the fly clients
-	if _, err := os.Stat(ctx.flyCLIPath); err != nil {
-		// Download it...
-		flyOut, flyOutErr := os.Create(ctx.flyCLIPath)
-		if nil != flyOutErr {
-			return nil, flyOutErr
-		}
-
-		client := &http.Client{}
-		httpReq, httpReqErr := http.NewRequest("GET", "http://localhost:8080/api/v1/cli?arch=amd64&platform=linux", nil)
-		if nil != httpReqErr {
-			return nil, httpReqErr
-		}
-		httpReq.SetBasicAuth(ctx.basicAuthUser, ctx.basicAuthPassword)
-		response, responseErr := client.Do(httpReq)
-		if responseErr != nil {
-			return nil, responseErr
-		}
-		defer response.Body.Close()
-		// Writer the body to file
-		_, copyErr := io.Copy(flyOut, response.Body)
-		flyOut.Close()
-		if copyErr != nil {
-			return nil, copyErr
-		}
-		chmodErr := os.Chmod(ctx.flyCLIPath, 755)
-		if nil != chmodErr {
-			return nil, chmodErr
-		}
-	}
-	// Run the commands to set the target, configure the pipeline
-	var pipelineCommands []*exec.Cmd
-	pipelineCommands = append(pipelineCommands,
-		exec.Command(ctx.flyCLIPath,
-			"login",
-			fmt.Sprintf("--username=%s", ctx.basicAuthUser),
-			fmt.Sprintf("--password=%s", ctx.basicAuthPassword),
-			"-t",
-			concourseTargetName,
-			"-c",
-			"http://localhost:8080"))
-
-	pipelineCommands = append(pipelineCommands,
-		exec.Command(ctx.flyCLIPath,
-			"-t",
-			concourseTargetName,
-			"set-pipeline",
-			"-p",
-			concoursePipelineName,
-			"-c",
-			path.Join(ctx.tempRepoPath, ctx.pipelineRelPath),
-			"-l",
-			ctx.localCredsPath,
-			"-n"))
-
-	pipelineCommands = append(pipelineCommands,
-		exec.Command(ctx.flyCLIPath,
-			"-t",
-			concourseTargetName,
-			"unpause-pipeline",
-			"-p",
-			concoursePipelineName))
-	// fly -t sparta unpause-pipeline -p SpartaCICD
-	for _, eachCommand := range pipelineCommands {
-		commandErr := runOSCommand(eachCommand, ctx.logger)
-		if nil != commandErr {
-			return nil, commandErr
+// Render the pipeline's config. The credential vars are only
+// interpolated for inline credential stores.
+func renderPipelineDefinition(ctx *workflowContext,
+	pipeline pipelineDefinition,
+	credentialVars map[string]interface{}) ([]byte, error) {
+	config, configErr := ioutil.ReadFile(pipeline.path)
+	if nil != configErr {
+		return nil, configErr
+	}
+	if ctx.credentialStore.inline() {
+		return renderPipelineConfig(config, credentialVars, true)
+	}
+	return renderPipelineConfig(config, nil, false)
+}
+
+// Render the pipeline's config with the credential vars, save it
+// and unpause the pipeline. Returns true if the pipeline was unchanged
+// since it was last applied and nothing was sent to the ATC.
+func setPipeline(ctx *workflowContext, pipeline pipelineDefinition) (bool, error) {
+	renderedConfig, renderedConfigErr := renderPipelineDefinition(ctx, pipeline, ctx.credentialVars)
+	if nil != renderedConfigErr {
+		return false, renderedConfigErr
+	}
+	// Credential manager ((vars)) are resolved by Concourse, so the
+	// config doesn't change when the credentials do
+	applied := appliedPipeline{
+		commitSHA: ctx.commitSHA,
+	}
+	if ctx.credentialStore.inline() {
+		applied.credentialsHash = ctx.credentialsHash
+	}
+	applied.configHash = contentHash(renderedConfig)
+	if previous, exists := ctx.state.appliedPipelines[pipeline.name]; exists && previous == applied {
+		return true, nil
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Pipeline":  pipeline.name,
+		"Path":      pipeline.path,
+		"CommitSHA": ctx.commitSHA,
+	}).Info("Setting pipeline")
+	setErr := ctx.atcClient.SetPipelineConfig(pipeline.name, renderedConfig)
+	if nil != setErr {
+		return false, setErr
+	}
+	unpauseErr := ctx.atcClient.UnpausePipeline(pipeline.name)
+	if nil != unpauseErr {
+		return false, unpauseErr
+	}
+	ctx.state.appliedPipelines[pipeline.name] = applied
+	return false, nil
+}
+
+// Destroy the previously applied pipelines whose definition is no longer
+// in the repo. Only pipelines set by SyncIt, including those saved in
+// the state file by a previous process, are candidates.
+func destroyRemovedPipelines(ctx *workflowContext) (syncStep, error) {
+	if !ctx.destroyRemoved {
+		return nil, nil
+	}
+	// A glob that matches nothing, e.g. after the pipelines are moved,
+	// would otherwise destroy every managed pipeline
+	if len(ctx.pipelines) == 0 {
+		return nil, fmt.Errorf("No pipelines match %s, not destroying the %d managed pipelines",
+			ctx.pipelineGlob,
+			len(ctx.state.appliedPipelines))
+	}
+	currentPipelines := make(map[string]bool)
+	for _, eachPipeline := range ctx.pipelines {
+		currentPipelines[eachPipeline.name] = true
+	}
+	for eachName := range ctx.state.appliedPipelines {
+		if currentPipelines[eachName] {
+			continue
 		}
+		result := pipelineResult{
+			Name:      eachName,
+			Destroyed: true,
+		}
+		result.Err = ctx.atcClient.DestroyPipeline(eachName)
+		if nil == result.Err {
+			delete(ctx.state.appliedPipelines, eachName)
+		}
+		ctx.results = append(ctx.results, result)
 	}
 	return nil, nil
 }
 
+// Log the per-pipeline results of a sync
+func logPipelineResults(ctx *workflowContext) {
+	for _, eachResult := range ctx.results {
+		entry := ctx.logger.WithFields(logrus.Fields{
+			"Pipeline":  eachResult.Name,
+			"Path":      eachResult.Path,
+			"Destroyed": eachResult.Destroyed,
+		})
+		if nil != eachResult.Err {
+			entry.WithFields(logrus.Fields{
+				"Error": eachResult.Err,
+			}).Error("Pipeline sync failed")
+		} else if eachResult.Unchanged {
+			entry.WithFields(logrus.Fields{
+				"CommitSHA":       ctx.commitSHA,
+				"CredentialsHash": ctx.credentialsHash,
+			}).Info("Pipeline unchanged (no-op)")
+		} else {
+			entry.Info("Pipeline synced")
+		}
+	}
+}
+
+// Log a warning if the last known credentials have expired or are within
+// the refresh margin
+func warnIfExpiring(ctx *workflowContext, now time.Time) {
+	if ctx.state.credentialsExpiry.IsZero() {
+		return
+	}
+	remaining := ctx.state.credentialsExpiry.Sub(now)
+	entry := ctx.logger.WithFields(logrus.Fields{
+		"Expiration": ctx.state.credentialsExpiry.Format(time.RFC3339),
+		"Remaining":  remaining.String(),
+		"Margin":     ctx.credentialsMargin.String(),
+	})
+	if remaining <= 0 {
+		entry.Warn("Pipeline credentials have expired")
+	} else if remaining <= ctx.credentialsMargin {
+		entry.Warn("Pipeline credentials expire within the refresh margin")
+	}
+}
+
+// Return the delay until the next sync. Pipelines must be set again
+// margin before the injected credentials expire, otherwise the
+// poll interval is used.
+func nextSyncDelay(expiration time.Time,
+	margin time.Duration,
+	pollInterval time.Duration,
+	now time.Time) time.Duration {
+	if expiration.IsZero() {
+		return pollInterval
+	}
+	untilRefresh := expiration.Add(-margin).Sub(now)
+	if untilRefresh < minimumSyncInterval {
+		return minimumSyncInterval
+	}
+	if untilRefresh < pollInterval {
+		return untilRefresh
+	}
+	return pollInterval
+}
+
+// Return the workflowContext for a single sync
+func newWorkflowContext(username string,
+	password string,
+	options *SyncOptions,
+	credentialProvider CredentialProvider,
+	credentialStore credentialStore,
+	state *syncState,
+	logger *logrus.Logger) *workflowContext {
+	return &workflowContext{
+		basicAuthUser:      username,
+		basicAuthPassword:  password,
+		logger:             logger,
+		repoURL:            options.RepoURL,
+		repoBranch:         options.Branch,
+		pipelineRelPath:    options.PipelinePath,
+		pipelineName:       options.PipelineName,
+		teamName:           options.TeamName,
+		concourseURL:       options.ConcourseURL,
+		pipelineGlob:       options.PipelineGlob,
+		destroyRemoved:     options.DestroyRemovedPipelines,
+		credentialsMargin:  options.CredentialsRefreshMargin,
+		credentialProvider: credentialProvider,
+		credentialStore:    credentialStore,
+		awsRegion:          options.AWSRegion,
+		s3Bucket:           options.S3Bucket,
+		state:              state,
+	}
+}
+
+// Run the syncStep chain and cleanup the cloned repo and local credentials
+func runWorkflow(ctx *workflowContext) {
+	logger := ctx.logger
+	for curStep := cloneRepo; curStep != nil; {
+		nextStep, nextStepErr := curStep(ctx)
+		if nil != nextStepErr {
+			logger.Error(nextStepErr)
+			if nil == ctx.syncErr {
+				ctx.syncErr = nextStepErr
+			}
+		}
+		curStep = nextStep
+	}
+	cleanupErr := ctx.credentialStore.cleanup()
+	if nil != cleanupErr {
+		logger.WithFields(logrus.Fields{
+			"Error": cleanupErr,
+		}).Warn("Failed to cleanup credentials")
+	}
+	if "" != ctx.tempRepoPath {
+		removeErr := os.RemoveAll(ctx.tempRepoPath)
+		if nil != removeErr {
+			logger.WithFields(logrus.Fields{
+				"Error": removeErr,
+			}).Warn("Failed to cleanup directory")
+		}
+	}
+}
+
+// Run the syncStep chain once
+func syncOnce(username string,
+	password string,
+	options *SyncOptions,
+	credentialProvider CredentialProvider,
+	credentialStore credentialStore,
+	state *syncState,
+	logger *logrus.Logger) *workflowContext {
+	logger.WithFields(logrus.Fields{
+		"RepoURL":  options.RepoURL,
+		"Branch":   options.Branch,
+		"Pipeline": options.PipelineName,
+		"Glob":     options.PipelineGlob,
+	}).Info("Rebuilding pipelines")
+	ctx := newWorkflowContext(username,
+		password,
+		options,
+		credentialProvider,
+		credentialStore,
+		state,
+		logger)
+	runWorkflow(ctx)
+	logPipelineResults(ctx)
+	return ctx
+}
+
 // SyncIt Periodically git clone the repo, check for pipelines, and create
-// new ones via the FLY cli
+// new ones via the ATC API
 // Ref: https://concourse.ci/fly-cli.html
 // We need to do this periodically b/c the EC2 instance requires
 // credentials to be injected into the pipelines...
-func SyncIt(username string, password string, logger *logrus.Logger) error {
+// If the webhook listener is enabled, push notifications for the repo
+// trigger an immediate sync. Syncs never overlap - triggers that arrive
+// during a sync are coalesced into a single follow-up sync.
+func SyncIt(username string,
+	password string,
+	options *SyncOptions,
+	logger *logrus.Logger) error {
+	credentialProvider, credentialProviderErr := NewCredentialProvider(options)
+	if nil != credentialProviderErr {
+		return credentialProviderErr
+	}
+	credentialStore, credentialStoreErr := newCredentialStore(options)
+	if nil != credentialStoreErr {
+		return credentialStoreErr
+	}
+	state := &syncState{
+		appliedPipelines: make(map[string]appliedPipeline),
+	}
+	if options.DestroyRemovedPipelines {
+		managedPipelines, managedPipelinesErr := loadManagedPipelines(options.StateFile)
+		if nil != managedPipelinesErr {
+			return managedPipelinesErr
+		}
+		// The applied config isn't saved, so these are set again by the
+		// next sync
+		for _, eachName := range managedPipelines {
+			state.appliedPipelines[eachName] = appliedPipeline{}
+		}
+	}
+	triggers := make(chan string, 1)
+	if "" != options.WebhookAddress {
+		listenErr := listenForWebhooks(options, triggers, logger)
+		if nil != listenErr {
+			return listenErr
+		}
+	}
+	var statusStore StatusStore
+	if "" != options.StatusParameterPrefix {
+		statusStore = &SSMStatusStore{
+			Region: options.AWSRegion,
+			Prefix: options.StatusParameterPrefix,
+		}
+		go pollSyncRequests(statusStore, triggers, logger)
+	}
 	for {
-		logger.Info("Rebuilding pipeline")
-		ctx := &workflowContext{
-			basicAuthUser:     username,
-			basicAuthPassword: password,
-			logger:            logger,
-			repoURL:           "https://github.com/mweagle/SpartaCICD",
-			localCredsPath:    "/home/ubuntu/aws-credentials.yml",
-			flyCLIPath:        "/home/ubuntu/fly",
-			pipelineRelPath:   "pipeline.yml",
-		}
-		for curStep := cloneRepo; curStep != nil; {
-			nextStep, nextStepErr := curStep(ctx)
-			if nil != nextStepErr {
-				logger.Error(nextStepErr)
-				break
-			} else {
-				curStep = nextStep
+		ctx := syncOnce(username,
+			password,
+			options,
+			credentialProvider,
+			credentialStore,
+			state,
+			logger)
+		if options.DestroyRemovedPipelines {
+			saveErr := saveManagedPipelines(options.StateFile, state.appliedPipelines)
+			if nil != saveErr {
+				logger.WithFields(logrus.Fields{
+					"Error": saveErr,
+					"Path":  options.StateFile,
+				}).Warn("Failed to save the managed pipelines")
 			}
 		}
-
-		if "" != ctx.tempRepoPath {
-			if _, err := os.Stat(ctx.tempRepoPath); err != nil {
-				removeErr := os.RemoveAll(ctx.tempRepoPath)
-				if nil != removeErr {
-					logger.WithFields(logrus.Fields{
-						"Error": removeErr,
-					}).Warn("Failed to cleanup directory")
-				}
+		if nil != statusStore {
+			putErr := statusStore.PutStatus(newSyncStatus(ctx, options.ExternalURL))
+			if nil != putErr {
+				logger.WithFields(logrus.Fields{
+					"Error": putErr,
+				}).Warn("Failed to publish sync status")
 			}
 		}
-		time.Sleep(5 * 60 * time.Second)
+
+		warnIfExpiring(ctx, time.Now())
+		syncDelay := nextSyncDelay(state.credentialsExpiry,
+			options.CredentialsRefreshMargin,
+			defaultPollInterval,
+			time.Now())
+		logger.WithFields(logrus.Fields{
+			"Delay":      syncDelay.String(),
+			"Expiration": state.credentialsExpiry.Format(time.RFC3339),
+		}).Info("Next sync scheduled")
+		select {
+		case <-time.After(syncDelay):
+			logger.Debug("Sync interval elapsed")
+		case reason := <-triggers:
+			logger.WithFields(logrus.Fields{
+				"Reason": reason,
+			}).Info("Sync triggered")
+		}
 	}
 }
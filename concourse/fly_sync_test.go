@@ -0,0 +1,397 @@
+package concourse
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Create the repo relative files in a temp directory
+func newTestRepo(t *testing.T, relPaths ...string) string {
+	repoPath, repoPathErr := ioutil.TempDir("", "SpartaCICDTest")
+	if nil != repoPathErr {
+		t.Fatal(repoPathErr)
+	}
+	for _, eachPath := range relPaths {
+		fullPath := filepath.Join(repoPath, eachPath)
+		mkdirErr := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if nil != mkdirErr {
+			t.Fatal(mkdirErr)
+		}
+		writeErr := ioutil.WriteFile(fullPath, []byte("jobs: []\n"), 0600)
+		if nil != writeErr {
+			t.Fatal(writeErr)
+		}
+	}
+	return repoPath
+}
+
+func TestDiscoverPipelinesGlob(t *testing.T) {
+	repoPath := newTestRepo(t, "ci/build.yml", "ci/deploy.yml")
+	defer os.RemoveAll(repoPath)
+
+	ctx := &workflowContext{
+		logger:       logrus.New(),
+		tempRepoPath: repoPath,
+		pipelineGlob: "ci/*.yml",
+	}
+	_, discoverErr := discoverPipelines(ctx)
+	if nil != discoverErr {
+		t.Fatal(discoverErr)
+	}
+	if len(ctx.pipelines) != 2 ||
+		ctx.pipelines[0].name != "build" ||
+		ctx.pipelines[1].name != "deploy" {
+		t.Fatalf("Unexpected pipelines: %#v", ctx.pipelines)
+	}
+}
+
+func TestDiscoverPipelinesDuplicateNames(t *testing.T) {
+	repoPath := newTestRepo(t, "ci/a/deploy.yml", "ci/b/deploy.yml")
+	defer os.RemoveAll(repoPath)
+
+	ctx := &workflowContext{
+		logger:       logrus.New(),
+		tempRepoPath: repoPath,
+		pipelineGlob: "ci/*/*.yml",
+	}
+	nextStep, discoverErr := discoverPipelines(ctx)
+	if nil == discoverErr || nil != nextStep {
+		t.Fatal("Expected pipelines with the same name to fail")
+	}
+}
+
+func TestManagedPipelinesState(t *testing.T) {
+	stateDir, stateDirErr := ioutil.TempDir("", "SpartaCICDTest")
+	if nil != stateDirErr {
+		t.Fatal(stateDirErr)
+	}
+	defer os.RemoveAll(stateDir)
+	statePath := filepath.Join(stateDir, "pipelines.json")
+
+	missing, missingErr := loadManagedPipelines(statePath)
+	if nil != missingErr || len(missing) != 0 {
+		t.Fatalf("Expected an empty set for a missing file: %v %v", missing, missingErr)
+	}
+	saveErr := saveManagedPipelines(statePath, map[string]appliedPipeline{
+		"deploy": {},
+		"build":  {commitSHA: "abc"},
+	})
+	if nil != saveErr {
+		t.Fatal(saveErr)
+	}
+	loaded, loadedErr := loadManagedPipelines(statePath)
+	if nil != loadedErr {
+		t.Fatal(loadedErr)
+	}
+	if len(loaded) != 2 || loaded[0] != "build" || loaded[1] != "deploy" {
+		t.Fatalf("Unexpected managed pipelines: %v", loaded)
+	}
+}
+
+// fakeCredentialProvider returns fixed credentials
+type fakeCredentialProvider struct {
+	creds *AWSCredentials
+	err   error
+}
+
+func (provider *fakeCredentialProvider) Retrieve() (*AWSCredentials, error) {
+	return provider.creds, provider.err
+}
+
+func TestNextSyncDelay(t *testing.T) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	margin := 10 * time.Minute
+	testCases := []struct {
+		expiration    time.Time
+		expectedDelay time.Duration
+	}{
+		// Credentials that don't expire use the poll interval
+		{time.Time{}, defaultPollInterval},
+		{now.Add(time.Hour), defaultPollInterval},
+		{now.Add(margin + defaultPollInterval), defaultPollInterval},
+		{now.Add(margin + 2*time.Minute), 2 * time.Minute},
+		// Clamped to the minimum interval
+		{now.Add(margin + time.Second), minimumSyncInterval},
+		{now.Add(margin), minimumSyncInterval},
+		{now.Add(-time.Hour), minimumSyncInterval},
+	}
+	for _, eachCase := range testCases {
+		delay := nextSyncDelay(eachCase.expiration, margin, defaultPollInterval, now)
+		if delay != eachCase.expectedDelay {
+			t.Fatalf("Expected a %s delay for %s, got %s",
+				eachCase.expectedDelay,
+				eachCase.expiration,
+				delay)
+		}
+	}
+}
+
+func TestWarnIfExpiring(t *testing.T) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		expiration      time.Time
+		expectedWarning string
+	}{
+		{time.Time{}, ""},
+		{now.Add(time.Hour), ""},
+		{now.Add(10*time.Minute + time.Second), ""},
+		{now.Add(10 * time.Minute), "expire within the refresh margin"},
+		{now.Add(time.Second), "expire within the refresh margin"},
+		{now, "have expired"},
+		{now.Add(-time.Hour), "have expired"},
+	}
+	for _, eachCase := range testCases {
+		var output bytes.Buffer
+		logger := logrus.New()
+		logger.Out = &output
+		ctx := &workflowContext{
+			logger:            logger,
+			credentialsMargin: 10 * time.Minute,
+			state: &syncState{
+				credentialsExpiry: eachCase.expiration,
+			},
+		}
+		warnIfExpiring(ctx, now)
+		if "" == eachCase.expectedWarning {
+			if 0 != output.Len() {
+				t.Fatalf("Unexpected warning for %s: %s", eachCase.expiration, output.String())
+			}
+		} else if !strings.Contains(output.String(), eachCase.expectedWarning) {
+			t.Fatalf("Expected %q for %s: %s",
+				eachCase.expectedWarning,
+				eachCase.expiration,
+				output.String())
+		}
+	}
+}
+
+func TestCredentialsExpiryPreservedAcrossFailedSyncs(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Round(time.Second)
+	state := &syncState{
+		appliedPipelines: make(map[string]appliedPipeline),
+	}
+	ctx := &workflowContext{
+		logger: logrus.New(),
+		credentialProvider: &fakeCredentialProvider{
+			creds: &AWSCredentials{
+				AccessKeyID:     "AKID",
+				SecretAccessKey: "SECRET",
+				Expiration:      expiration,
+			},
+		},
+		credentialStore: &inlineCredentialStore{},
+		state:           state,
+	}
+	_, refreshErr := refreshCredentials(ctx)
+	if nil != refreshErr {
+		t.Fatal(refreshErr)
+	}
+	if !state.credentialsExpiry.Equal(expiration) {
+		t.Fatalf("Unexpected credentials expiry: %s", state.credentialsExpiry)
+	}
+
+	// A sync that fails to clone the repo doesn't refresh the credentials
+	repoPath := newTestRepo(t)
+	defer os.RemoveAll(repoPath)
+	ctx = &workflowContext{
+		logger:     logrus.New(),
+		repoURL:    filepath.Join(repoPath, "missing"),
+		repoBranch: "master",
+		credentialProvider: &fakeCredentialProvider{
+			err: fmt.Errorf("Unexpected credentials refresh"),
+		},
+		credentialStore: &inlineCredentialStore{},
+		state:           state,
+	}
+	runWorkflow(ctx)
+	if nil == ctx.syncErr {
+		t.Fatal("Expected the clone to fail")
+	}
+	if !state.credentialsExpiry.Equal(expiration) {
+		t.Fatalf("The credentials expiry wasn't preserved: %s", state.credentialsExpiry)
+	}
+	delay := nextSyncDelay(state.credentialsExpiry, 58*time.Minute, defaultPollInterval, time.Now())
+	if delay >= defaultPollInterval {
+		t.Fatalf("Expected the next sync before the credentials expire, got %s", delay)
+	}
+}
+
+func TestDestroyRemovedPipelines(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	atcClient := newTestATCClient(atc)
+	loginErr := atcClient.Login()
+	if nil != loginErr {
+		t.Fatal(loginErr)
+	}
+
+	testCases := []struct {
+		name              string
+		pipelines         []pipelineDefinition
+		expectErr         bool
+		expectedRequests  []string
+		expectedPipelines []string
+	}{
+		{
+			name: "removed pipeline",
+			pipelines: []pipelineDefinition{
+				{name: "existing", path: "ci/existing.yml"},
+			},
+			expectedRequests:  []string{"DELETE /api/v1/teams/main/pipelines/removed"},
+			expectedPipelines: []string{"existing"},
+		},
+		{
+			name:              "no matching pipelines",
+			expectErr:         true,
+			expectedPipelines: []string{"existing", "removed"},
+		},
+	}
+	for _, eachCase := range testCases {
+		atc.requests = nil
+		ctx := &workflowContext{
+			logger:         logrus.New(),
+			pipelineGlob:   "ci/*.yml",
+			destroyRemoved: true,
+			pipelines:      eachCase.pipelines,
+			atcClient:      atcClient,
+			state: &syncState{
+				appliedPipelines: map[string]appliedPipeline{
+					"existing": {},
+					"removed":  {},
+				},
+			},
+		}
+		nextStep, destroyErr := destroyRemovedPipelines(ctx)
+		if nil != nextStep || (nil != destroyErr) != eachCase.expectErr {
+			t.Fatalf("%s: unexpected result: %v", eachCase.name, destroyErr)
+		}
+		if len(atc.requests) != len(eachCase.expectedRequests) {
+			t.Fatalf("%s: unexpected ATC requests: %v", eachCase.name, atc.requests)
+		}
+		for eachIndex, eachRequest := range eachCase.expectedRequests {
+			if atc.requests[eachIndex] != eachRequest {
+				t.Fatalf("%s: unexpected ATC requests: %v", eachCase.name, atc.requests)
+			}
+		}
+		if len(ctx.state.appliedPipelines) != len(eachCase.expectedPipelines) {
+			t.Fatalf("%s: unexpected managed pipelines: %v", eachCase.name, ctx.state.appliedPipelines)
+		}
+		for _, eachName := range eachCase.expectedPipelines {
+			if _, exists := ctx.state.appliedPipelines[eachName]; !exists {
+				t.Fatalf("%s: expected %s to be managed: %v",
+					eachCase.name,
+					eachName,
+					ctx.state.appliedPipelines)
+			}
+		}
+	}
+}
+
+// fakeCredentialStore is a credential manager store that keeps the
+// ((vars)) in the config
+type fakeCredentialStore struct {
+}
+
+func (fakeStore *fakeCredentialStore) store(vars map[string]interface{}) error {
+	return nil
+}
+
+func (fakeStore *fakeCredentialStore) cleanup() error {
+	return nil
+}
+
+func (fakeStore *fakeCredentialStore) inline() bool {
+	return false
+}
+
+func TestSetPipelineSkipsUnchanged(t *testing.T) {
+	atc := newFakeATC()
+	defer atc.server.Close()
+	atcClient := newTestATCClient(atc)
+	loginErr := atcClient.Login()
+	if nil != loginErr {
+		t.Fatal(loginErr)
+	}
+	repoPath := newTestRepo(t, "ci/existing.yml")
+	defer os.RemoveAll(repoPath)
+	pipeline := pipelineDefinition{
+		name: "existing",
+		path: filepath.Join(repoPath, "ci/existing.yml"),
+	}
+
+	const (
+		buildConfig  = "jobs:\n- name: build\n  plan:\n  - task: build\n    params:\n      KEY: ((access-key-id))\n"
+		deployConfig = "jobs:\n- name: deploy\n  plan:\n  - task: deploy\n    params:\n      KEY: ((access-key-id))\n"
+	)
+	testCases := []struct {
+		name            string
+		store           credentialStore
+		config          string
+		commitSHA       string
+		accessKeyID     string
+		expectUnchanged bool
+	}{
+		{"initial", &inlineCredentialStore{}, buildConfig, "abc", "AKID1", false},
+		{"unchanged", &inlineCredentialStore{}, buildConfig, "abc", "AKID1", true},
+		{"new commit", &inlineCredentialStore{}, buildConfig, "def", "AKID1", false},
+		{"changed config", &inlineCredentialStore{}, deployConfig, "def", "AKID1", false},
+		{"rotated credentials", &inlineCredentialStore{}, deployConfig, "def", "AKID2", false},
+		{"unchanged after rotation", &inlineCredentialStore{}, deployConfig, "def", "AKID2", true},
+		// Credential managers resolve the ((vars)), so rotated credentials
+		// don't change the config
+		{"credential manager initial", &fakeCredentialStore{}, deployConfig, "def", "AKID2", false},
+		{"credential manager rotated credentials", &fakeCredentialStore{}, deployConfig, "def", "AKID3", true},
+		{"credential manager changed config", &fakeCredentialStore{}, buildConfig, "def", "AKID3", false},
+	}
+	state := &syncState{
+		appliedPipelines: make(map[string]appliedPipeline),
+	}
+	for _, eachCase := range testCases {
+		writeErr := ioutil.WriteFile(pipeline.path, []byte(eachCase.config), 0600)
+		if nil != writeErr {
+			t.Fatal(writeErr)
+		}
+		credentialVars := map[string]interface{}{
+			"access-key-id": eachCase.accessKeyID,
+		}
+		ctx := &workflowContext{
+			logger:          logrus.New(),
+			commitSHA:       eachCase.commitSHA,
+			credentialsHash: eachCase.accessKeyID,
+			credentialVars:  credentialVars,
+			credentialStore: eachCase.store,
+			atcClient:       atcClient,
+			state:           state,
+		}
+		putCount := len(atc.putBodies)
+		unchanged, setErr := setPipeline(ctx, pipeline)
+		if nil != setErr {
+			t.Fatalf("%s: %s", eachCase.name, setErr)
+		}
+		if unchanged != eachCase.expectUnchanged {
+			t.Fatalf("%s: expected unchanged to be %t", eachCase.name, eachCase.expectUnchanged)
+		}
+		expectedPutCount := putCount + 1
+		if eachCase.expectUnchanged {
+			expectedPutCount = putCount
+		}
+		if len(atc.putBodies) != expectedPutCount {
+			t.Fatalf("%s: unexpected config PUTs: %d", eachCase.name, len(atc.putBodies)-putCount)
+		}
+		if !eachCase.expectUnchanged {
+			putBody := atc.putBodies[len(atc.putBodies)-1]
+			_, isInline := eachCase.store.(*inlineCredentialStore)
+			if isInline != strings.Contains(putBody, eachCase.accessKeyID) {
+				t.Fatalf("%s: unexpected config: %s", eachCase.name, putBody)
+			}
+		}
+	}
+}
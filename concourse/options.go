@@ -0,0 +1,207 @@
+package concourse
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultRepoURL           = "https://github.com/mweagle/SpartaCICD"
+	defaultRepoBranch        = "master"
+	defaultPipelineRelPath   = "pipeline.yml"
+	defaultPipelineName      = "SpartaCICD"
+	defaultConcourseURL      = "http://localhost:8080"
+	defaultCredentialsMargin = 15 * time.Minute
+	defaultStateFileName     = "SpartaCICD-pipelines.json"
+)
+
+// SyncOptions defines the repository, pipeline and Concourse
+// settings used by SyncIt. Empty values are replaced by the
+// SpartaCICD defaults.
+type SyncOptions struct {
+	RepoURL      string `json:"repoURL"`
+	Branch       string `json:"branch"`
+	PipelinePath string `json:"pipelinePath"`
+	PipelineName string `json:"pipelineName"`
+	TeamName     string `json:"teamName"`
+	ConcourseURL string `json:"concourseURL"`
+	// PipelineGlob is a repository relative glob (eg: ci/pipelines/*.yml).
+	// When set, every matching file is synced as a pipeline named
+	// after the file and PipelinePath/PipelineName are ignored.
+	PipelineGlob string `json:"pipelineGlob"`
+	// DestroyRemovedPipelines destroys pipelines previously set by
+	// SyncIt whose file is no longer in the repo
+	DestroyRemovedPipelines bool `json:"destroyRemovedPipelines"`
+	// StateFile records the pipelines set by SyncIt when removed
+	// pipelines are destroyed (default: $TMPDIR/SpartaCICD-pipelines.json)
+	StateFile string `json:"stateFile"`
+	// WebhookAddress is the optional listen address (eg: :9090) for
+	// GitHub/GitLab push webhooks that trigger an immediate sync
+	WebhookAddress string `json:"webhookAddress"`
+	// WebhookSecret is the shared secret used to verify webhook requests
+	WebhookSecret string `json:"webhookSecret"`
+	// CredentialsRefreshMargin is how long before the injected
+	// credentials expire that the pipelines are set again. The
+	// config file value is a duration string (eg: 15m).
+	CredentialsRefreshMargin time.Duration `json:"-"`
+	// CredentialProvider is the source of the injected credentials:
+	// ec2 (default), env, shared or assume-role
+	CredentialProvider       string `json:"credentialProvider"`
+	SharedCredentialsFile    string `json:"sharedCredentialsFile"`
+	SharedCredentialsProfile string `json:"sharedCredentialsProfile"`
+	// AssumeRoleBaseProvider is the provider whose credentials are used
+	// to assume AssumeRoleARN (default: ec2)
+	AssumeRoleBaseProvider string `json:"assumeRoleBaseProvider"`
+	AssumeRoleARN          string `json:"assumeRoleARN"`
+	AssumeRoleExternalID   string `json:"assumeRoleExternalID"`
+	// AWSRegion is used for STS requests and the aws-region pipeline var
+	AWSRegion string `json:"awsRegion"`
+	// S3Bucket is the s3-bucket pipeline var. The provisioned stack uses
+	// its artifact bucket.
+	S3Bucket string `json:"s3Bucket"`
+	// MetadataURL is the EC2 instance metadata service base URL
+	MetadataURL string `json:"metadataURL"`
+	// AllowIMDSv1 enables IMDSv1 requests when an IMDSv2 token can't
+	// be obtained
+	AllowIMDSv1 bool `json:"allowIMDSv1"`
+	// CredentialStore is where the pipeline credential vars are saved:
+	// inline (default), vault or ssm. Inline vars are interpolated into
+	// the pipeline config and never written to disk. The vault and ssm
+	// stores require the pipelines to use ((var)) placeholders and a
+	// Concourse web node configured with the matching credential manager.
+	// The provisioned stack doesn't configure one, so they're only
+	// supported when syncing to an externally managed Concourse.
+	CredentialStore string `json:"credentialStore"`
+	// CredentialPathPrefix is the Vault path or SSM parameter prefix
+	// (default: /concourse). Vars are saved to PREFIX/TEAM/VAR.
+	CredentialPathPrefix string `json:"credentialPathPrefix"`
+	// VaultAddress defaults to $VAULT_ADDR
+	VaultAddress string `json:"vaultAddress"`
+	// VaultToken defaults to $VAULT_TOKEN
+	VaultToken string `json:"vaultToken"`
+	// SSMKMSKeyID is the optional KMS key for the SSM SecureString params
+	SSMKMSKeyID string `json:"ssmKMSKeyID"`
+	// ExternalURL is the Concourse URL reported to the control plane
+	// (default: ConcourseURL)
+	ExternalURL string `json:"externalURL"`
+	// StatusParameterPrefix is the optional SSM parameter prefix where the
+	// sync status is published and control plane sync requests are read
+	StatusParameterPrefix string `json:"statusParameterPrefix"`
+}
+
+// Return the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, eachValue := range values {
+		if "" != eachValue {
+			return eachValue
+		}
+	}
+	return ""
+}
+
+// Return the boolean override if it was set explicitly, s.t. an explicit
+// false wins over the config file. Otherwise either value enables it.
+func overrideBool(name string,
+	explicitOverrides map[string]bool,
+	override bool,
+	fileValue bool) bool {
+	if explicitOverrides[name] {
+		return override
+	}
+	return override || fileValue
+}
+
+// NewSyncOptions returns the SyncOptions produced by layering the
+// non-empty overrides on top of the optional JSON configFile. Any values
+// that are still empty are set to the defaults. explicitOverrides holds the
+// JSON names of the boolean overrides that were explicitly set.
+func NewSyncOptions(configFile string,
+	overrides SyncOptions,
+	explicitOverrides map[string]bool) (*SyncOptions, error) {
+	var fileOptions struct {
+		SyncOptions
+		CredentialsRefreshMargin string `json:"credentialsRefreshMargin"`
+	}
+	if "" != configFile {
+		configContents, configContentsErr := ioutil.ReadFile(configFile)
+		if nil != configContentsErr {
+			return nil, configContentsErr
+		}
+		unmarshalErr := json.Unmarshal(configContents, &fileOptions)
+		if nil != unmarshalErr {
+			return nil, unmarshalErr
+		}
+	}
+	credentialsMargin := overrides.CredentialsRefreshMargin
+	if credentialsMargin <= 0 && "" != fileOptions.CredentialsRefreshMargin {
+		parsedMargin, parsedMarginErr := time.ParseDuration(fileOptions.CredentialsRefreshMargin)
+		if nil != parsedMarginErr {
+			return nil, parsedMarginErr
+		}
+		credentialsMargin = parsedMargin
+	}
+	if credentialsMargin <= 0 {
+		credentialsMargin = defaultCredentialsMargin
+	}
+	return &SyncOptions{
+		RepoURL:      firstNonEmpty(overrides.RepoURL, fileOptions.RepoURL, defaultRepoURL),
+		Branch:       firstNonEmpty(overrides.Branch, fileOptions.Branch, defaultRepoBranch),
+		PipelinePath: firstNonEmpty(overrides.PipelinePath, fileOptions.PipelinePath, defaultPipelineRelPath),
+		PipelineName: firstNonEmpty(overrides.PipelineName, fileOptions.PipelineName, defaultPipelineName),
+		TeamName:     firstNonEmpty(overrides.TeamName, fileOptions.TeamName, defaultTeamName),
+		ConcourseURL: firstNonEmpty(overrides.ConcourseURL, fileOptions.ConcourseURL, defaultConcourseURL),
+		PipelineGlob: firstNonEmpty(overrides.PipelineGlob, fileOptions.PipelineGlob),
+		DestroyRemovedPipelines: overrideBool("destroyRemovedPipelines",
+			explicitOverrides,
+			overrides.DestroyRemovedPipelines,
+			fileOptions.DestroyRemovedPipelines),
+		StateFile: firstNonEmpty(overrides.StateFile,
+			fileOptions.StateFile,
+			filepath.Join(os.TempDir(), defaultStateFileName)),
+		WebhookAddress:           firstNonEmpty(overrides.WebhookAddress, fileOptions.WebhookAddress),
+		WebhookSecret:            firstNonEmpty(overrides.WebhookSecret, fileOptions.WebhookSecret),
+		CredentialsRefreshMargin: credentialsMargin,
+		CredentialProvider: firstNonEmpty(overrides.CredentialProvider,
+			fileOptions.CredentialProvider,
+			defaultCredentialProvider),
+		SharedCredentialsFile: firstNonEmpty(overrides.SharedCredentialsFile,
+			fileOptions.SharedCredentialsFile),
+		SharedCredentialsProfile: firstNonEmpty(overrides.SharedCredentialsProfile,
+			fileOptions.SharedCredentialsProfile),
+		AssumeRoleBaseProvider: firstNonEmpty(overrides.AssumeRoleBaseProvider,
+			fileOptions.AssumeRoleBaseProvider,
+			defaultCredentialProvider),
+		AssumeRoleARN:        firstNonEmpty(overrides.AssumeRoleARN, fileOptions.AssumeRoleARN),
+		AssumeRoleExternalID: firstNonEmpty(overrides.AssumeRoleExternalID, fileOptions.AssumeRoleExternalID),
+		AWSRegion:            firstNonEmpty(overrides.AWSRegion, fileOptions.AWSRegion, defaultAWSRegion),
+		S3Bucket:             firstNonEmpty(overrides.S3Bucket, fileOptions.S3Bucket),
+		MetadataURL:          firstNonEmpty(overrides.MetadataURL, fileOptions.MetadataURL, ec2MetadataServer),
+		AllowIMDSv1: overrideBool("allowIMDSv1",
+			explicitOverrides,
+			overrides.AllowIMDSv1,
+			fileOptions.AllowIMDSv1),
+		CredentialStore: firstNonEmpty(overrides.CredentialStore,
+			fileOptions.CredentialStore,
+			defaultCredentialStore),
+		CredentialPathPrefix: firstNonEmpty(overrides.CredentialPathPrefix,
+			fileOptions.CredentialPathPrefix,
+			defaultCredentialPathPrefix),
+		VaultAddress: firstNonEmpty(overrides.VaultAddress,
+			fileOptions.VaultAddress,
+			os.Getenv("VAULT_ADDR")),
+		VaultToken: firstNonEmpty(overrides.VaultToken,
+			fileOptions.VaultToken,
+			os.Getenv("VAULT_TOKEN")),
+		SSMKMSKeyID: firstNonEmpty(overrides.SSMKMSKeyID, fileOptions.SSMKMSKeyID),
+		ExternalURL: firstNonEmpty(overrides.ExternalURL,
+			fileOptions.ExternalURL,
+			overrides.ConcourseURL,
+			fileOptions.ConcourseURL,
+			defaultConcourseURL),
+		StatusParameterPrefix: firstNonEmpty(overrides.StatusParameterPrefix,
+			fileOptions.StatusParameterPrefix),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package concourse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSyncOptionsBoolPrecedence(t *testing.T) {
+	configDir, configDirErr := ioutil.TempDir("", "SpartaCICDTest")
+	if nil != configDirErr {
+		t.Fatal(configDirErr)
+	}
+	defer os.RemoveAll(configDir)
+	enabledConfig := filepath.Join(configDir, "enabled.json")
+	writeErr := ioutil.WriteFile(enabledConfig,
+		[]byte(`{"destroyRemovedPipelines": true, "allowIMDSv1": true}`),
+		0600)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+
+	testCases := []struct {
+		name              string
+		configFile        string
+		override          bool
+		explicitOverrides map[string]bool
+		expected          bool
+	}{
+		{"default", "", false, nil, false},
+		{"config file", enabledConfig, false, nil, true},
+		{"flag", "", true, map[string]bool{"destroyRemovedPipelines": true, "allowIMDSv1": true}, true},
+		{"explicit false flag", enabledConfig, false, map[string]bool{"destroyRemovedPipelines": true, "allowIMDSv1": true}, false},
+		{"explicit true flag", enabledConfig, true, map[string]bool{"destroyRemovedPipelines": true, "allowIMDSv1": true}, true},
+	}
+	for _, eachCase := range testCases {
+		syncOptions, syncOptionsErr := NewSyncOptions(eachCase.configFile,
+			SyncOptions{
+				DestroyRemovedPipelines: eachCase.override,
+				AllowIMDSv1:             eachCase.override,
+			},
+			eachCase.explicitOverrides)
+		if nil != syncOptionsErr {
+			t.Fatalf("%s: %s", eachCase.name, syncOptionsErr)
+		}
+		if syncOptions.DestroyRemovedPipelines != eachCase.expected ||
+			syncOptions.AllowIMDSv1 != eachCase.expected {
+			t.Fatalf("%s: expected %t: %#v", eachCase.name, eachCase.expected, syncOptions)
+		}
+	}
+
+	// Only the explicitly set option overrides the config file
+	syncOptions, syncOptionsErr := NewSyncOptions(enabledConfig,
+		SyncOptions{},
+		map[string]bool{"allowIMDSv1": true})
+	if nil != syncOptionsErr {
+		t.Fatal(syncOptionsErr)
+	}
+	if !syncOptions.DestroyRemovedPipelines || syncOptions.AllowIMDSv1 {
+		t.Fatalf("Unexpected options: %#v", syncOptions)
+	}
+}
@@ -0,0 +1,381 @@
+package concourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pipeline config sections that are compared by the diff
+var pipelineDiffSections = []string{
+	"resource_types",
+	"resources",
+	"jobs",
+	"groups",
+}
+
+// Credential vars that change whenever the credentials are refreshed.
+// They're rendered as placeholders that match any deployed value s.t. a
+// credential refresh isn't reported as a change.
+var volatileCredentialVars = []string{
+	"access-key-id",
+	"secret-access-key",
+	"session-token",
+}
+
+const volatileVarPlaceholder = "__SPARTA_CICD_VOLATILE_VAR__"
+
+// PipelineDiffExitCode is the pipeline-diff exit code when a sync would
+// change a pipeline
+const PipelineDiffExitCode = 2
+
+// Kinds of PipelineChange
+const (
+	PipelineChangeAdded   = "added"
+	PipelineChangeRemoved = "removed"
+	PipelineChangeChanged = "changed"
+)
+
+// PipelineChange is a resource type, resource, job or group that differs
+// between the repo and the ATC
+type PipelineChange struct {
+	Section string
+	Name    string
+	Kind    string
+	// Top level keys that differ for changed items
+	Fields []string
+}
+
+// PipelineDiff is the set of changes that syncing the pipeline would apply
+type PipelineDiff struct {
+	Name string
+	Path string
+	// The pipeline doesn't exist in the ATC
+	Created bool
+	Changes []PipelineChange
+}
+
+// HasChanges returns true if syncing the pipeline would change it
+func (diff *PipelineDiff) HasChanges() bool {
+	return diff.Created || len(diff.Changes) != 0
+}
+
+// Return the vars used to render the planned config, with the volatile
+// credential vars replaced by placeholders
+func planCredentialVars(vars map[string]interface{}) map[string]interface{} {
+	planVars := make(map[string]interface{})
+	for eachName, eachValue := range vars {
+		planVars[eachName] = eachValue
+	}
+	for _, eachName := range volatileCredentialVars {
+		if _, exists := planVars[eachName]; exists {
+			planVars[eachName] = volatileVarPlaceholder
+		}
+	}
+	return planVars
+}
+
+// Remove the empty values that the ATC omits from the config it returns
+func normalizeConfigValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{})
+		for eachKey, eachValue := range typedValue {
+			if normalizedValue := normalizeConfigValue(eachValue); nil != normalizedValue {
+				normalized[eachKey] = normalizedValue
+			}
+		}
+		if len(normalized) <= 0 {
+			return nil
+		}
+		return normalized
+	case []interface{}:
+		if len(typedValue) <= 0 {
+			return nil
+		}
+		normalized := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			normalized[eachIndex] = normalizeConfigValue(eachValue)
+		}
+		return normalized
+	case string:
+		if "" == typedValue {
+			return nil
+		}
+	case bool:
+		if !typedValue {
+			return nil
+		}
+	}
+	return value
+}
+
+// Returns true if the planned value matches the deployed value. Planned
+// strings that include the volatile placeholder match any deployed string
+// with the same surrounding text.
+func configValuesMatch(planned interface{}, deployed interface{}) bool {
+	switch typedPlanned := planned.(type) {
+	case map[string]interface{}:
+		typedDeployed, typedDeployedOk := deployed.(map[string]interface{})
+		if !typedDeployedOk || len(typedPlanned) != len(typedDeployed) {
+			return false
+		}
+		for eachKey, eachValue := range typedPlanned {
+			deployedValue, exists := typedDeployed[eachKey]
+			if !exists || !configValuesMatch(eachValue, deployedValue) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		typedDeployed, typedDeployedOk := deployed.([]interface{})
+		if !typedDeployedOk || len(typedPlanned) != len(typedDeployed) {
+			return false
+		}
+		for eachIndex, eachValue := range typedPlanned {
+			if !configValuesMatch(eachValue, typedDeployed[eachIndex]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		typedDeployed, typedDeployedOk := deployed.(string)
+		if !typedDeployedOk {
+			return false
+		}
+		if !strings.Contains(typedPlanned, volatileVarPlaceholder) {
+			return typedPlanned == typedDeployed
+		}
+		pattern := strings.Replace(regexp.QuoteMeta(typedPlanned),
+			regexp.QuoteMeta(volatileVarPlaceholder),
+			".*",
+			-1)
+		return regexp.MustCompile("^(?s:" + pattern + ")$").MatchString(typedDeployed)
+	default:
+		return reflect.DeepEqual(planned, deployed)
+	}
+}
+
+// Return the named items in a config section
+func configSectionItems(config map[string]interface{}, section string) (map[string]map[string]interface{}, error) {
+	items := make(map[string]map[string]interface{})
+	sectionValue, exists := config[section]
+	if !exists || nil == sectionValue {
+		return items, nil
+	}
+	sectionItems, sectionItemsOk := sectionValue.([]interface{})
+	if !sectionItemsOk {
+		return nil, fmt.Errorf("Pipeline %s must be a list", section)
+	}
+	for _, eachItem := range sectionItems {
+		item, itemOk := eachItem.(map[string]interface{})
+		if !itemOk {
+			return nil, fmt.Errorf("Pipeline %s must be a list of objects", section)
+		}
+		name, _ := item["name"].(string)
+		items[name] = item
+	}
+	return items, nil
+}
+
+// Return the sorted map keys
+func sortedItemNames(items map[string]map[string]interface{}) []string {
+	var names []string
+	for eachName := range items {
+		names = append(names, eachName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the changes between the rendered YAML config and the JSON config
+// returned by the ATC
+func diffPipelineConfig(renderedConfig []byte, deployedConfig json.RawMessage) ([]PipelineChange, error) {
+	plannedJSON, plannedJSONErr := yaml.YAMLToJSON(renderedConfig)
+	if nil != plannedJSONErr {
+		return nil, plannedJSONErr
+	}
+	var planned map[string]interface{}
+	plannedErr := json.Unmarshal(plannedJSON, &planned)
+	if nil != plannedErr {
+		return nil, plannedErr
+	}
+	var deployed map[string]interface{}
+	deployedErr := json.Unmarshal(deployedConfig, &deployed)
+	if nil != deployedErr {
+		return nil, deployedErr
+	}
+	var changes []PipelineChange
+	for _, eachSection := range pipelineDiffSections {
+		plannedItems, plannedItemsErr := configSectionItems(planned, eachSection)
+		if nil != plannedItemsErr {
+			return nil, plannedItemsErr
+		}
+		deployedItems, deployedItemsErr := configSectionItems(deployed, eachSection)
+		if nil != deployedItemsErr {
+			return nil, deployedItemsErr
+		}
+		for _, eachName := range sortedItemNames(plannedItems) {
+			deployedItem, exists := deployedItems[eachName]
+			if !exists {
+				changes = append(changes, PipelineChange{
+					Section: eachSection,
+					Name:    eachName,
+					Kind:    PipelineChangeAdded,
+				})
+				continue
+			}
+			plannedItem, _ := normalizeConfigValue(plannedItems[eachName]).(map[string]interface{})
+			normalizedDeployed, _ := normalizeConfigValue(deployedItem).(map[string]interface{})
+			fieldNames := make(map[string]bool)
+			for eachField := range plannedItem {
+				fieldNames[eachField] = true
+			}
+			for eachField := range normalizedDeployed {
+				fieldNames[eachField] = true
+			}
+			var changedFields []string
+			for eachField := range fieldNames {
+				if !configValuesMatch(plannedItem[eachField], normalizedDeployed[eachField]) {
+					changedFields = append(changedFields, eachField)
+				}
+			}
+			if len(changedFields) != 0 {
+				sort.Strings(changedFields)
+				changes = append(changes, PipelineChange{
+					Section: eachSection,
+					Name:    eachName,
+					Kind:    PipelineChangeChanged,
+					Fields:  changedFields,
+				})
+			}
+		}
+		for _, eachName := range sortedItemNames(deployedItems) {
+			if _, exists := plannedItems[eachName]; !exists {
+				changes = append(changes, PipelineChange{
+					Section: eachSection,
+					Name:    eachName,
+					Kind:    PipelineChangeRemoved,
+				})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Render each pipeline and diff it against the config in the ATC. Nothing
+// is sent to the ATC or the credential store.
+func planPipelines(ctx *workflowContext) (syncStep, error) {
+	ctx.atcClient = NewATCClient(ctx.concourseURL,
+		ctx.teamName,
+		ctx.basicAuthUser,
+		ctx.basicAuthPassword)
+	loginErr := ctx.atcClient.Login()
+	if nil != loginErr {
+		return nil, loginErr
+	}
+	for _, eachPipeline := range ctx.pipelines {
+		renderedConfig, renderedConfigErr := renderPipelineDefinition(ctx,
+			eachPipeline,
+			planCredentialVars(ctx.credentialVars))
+		if nil != renderedConfigErr {
+			return nil, renderedConfigErr
+		}
+		deployedConfig, configVersion, deployedConfigErr := ctx.atcClient.PipelineConfig(eachPipeline.name)
+		if nil != deployedConfigErr {
+			return nil, deployedConfigErr
+		}
+		diff := PipelineDiff{
+			Name:    eachPipeline.name,
+			Path:    eachPipeline.path,
+			Created: "" == configVersion,
+		}
+		if !diff.Created {
+			changes, changesErr := diffPipelineConfig(renderedConfig, deployedConfig)
+			if nil != changesErr {
+				return nil, fmt.Errorf("Failed to diff pipeline %s: %s", eachPipeline.name, changesErr.Error())
+			}
+			diff.Changes = changes
+		}
+		ctx.diffs = append(ctx.diffs, diff)
+	}
+	return nil, nil
+}
+
+// PlanPipelines clones the repo, renders the pipelines and returns the
+// changes that a sync would apply to each one. Pipelines aren't set and
+// credentials aren't saved.
+func PlanPipelines(username string,
+	password string,
+	options *SyncOptions,
+	logger *logrus.Logger) ([]PipelineDiff, error) {
+	credentialProvider, credentialProviderErr := NewCredentialProvider(options)
+	if nil != credentialProviderErr {
+		return nil, credentialProviderErr
+	}
+	credentialStore, credentialStoreErr := newCredentialStore(options)
+	if nil != credentialStoreErr {
+		return nil, credentialStoreErr
+	}
+	ctx := newWorkflowContext(username,
+		password,
+		options,
+		credentialProvider,
+		credentialStore,
+		&syncState{
+			appliedPipelines: make(map[string]appliedPipeline),
+		},
+		logger)
+	ctx.planOnly = true
+	runWorkflow(ctx)
+	return ctx.diffs, ctx.syncErr
+}
+
+// PipelineDiffsExitCode returns PipelineDiffExitCode if any pipeline has
+// changes and 0 otherwise
+func PipelineDiffsExitCode(diffs []PipelineDiff) int {
+	for _, eachDiff := range diffs {
+		if eachDiff.HasChanges() {
+			return PipelineDiffExitCode
+		}
+	}
+	return 0
+}
+
+// WritePipelineDiffs prints the pipeline changes. Added items are prefixed
+// with +, removed items with - and changed items with ~.
+func WritePipelineDiffs(w io.Writer, diffs []PipelineDiff) {
+	changedCount := 0
+	for _, eachDiff := range diffs {
+		if !eachDiff.HasChanges() {
+			fmt.Fprintf(w, "pipeline %s: no changes\n", eachDiff.Name)
+			continue
+		}
+		changedCount++
+		if eachDiff.Created {
+			fmt.Fprintf(w, "pipeline %s: + new pipeline (%s)\n", eachDiff.Name, eachDiff.Path)
+			continue
+		}
+		fmt.Fprintf(w, "pipeline %s:\n", eachDiff.Name)
+		for _, eachChange := range eachDiff.Changes {
+			switch eachChange.Kind {
+			case PipelineChangeAdded:
+				fmt.Fprintf(w, "  + %s/%s\n", eachChange.Section, eachChange.Name)
+			case PipelineChangeRemoved:
+				fmt.Fprintf(w, "  - %s/%s\n", eachChange.Section, eachChange.Name)
+			default:
+				fmt.Fprintf(w, "  ~ %s/%s (%s)\n",
+					eachChange.Section,
+					eachChange.Name,
+					strings.Join(eachChange.Fields, ", "))
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d of %d pipelines have changes\n", changedCount, len(diffs))
+}
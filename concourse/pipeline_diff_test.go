@@ -0,0 +1,229 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Deployed config as returned by the ATC
+const testDeployedConfig = `{
+	"resources": [
+		{"name": "repo", "type": "git", "source": {"uri": "https://github.com/mweagle/SpartaCICD.git", "branch": "master"}},
+		{"name": "artifacts", "type": "s3", "source": {"bucket": "weyland", "access_key_id": "AKIAOLD", "secret_access_key": "old"}},
+		{"name": "nightly", "type": "time", "source": {"interval": "24h"}}
+	],
+	"jobs": [
+		{"name": "build", "public": false, "plan": [{"get": "repo", "trigger": true}]},
+		{"name": "deploy", "serial": true, "plan": [{"get": "repo"}]}
+	]
+}`
+
+func TestDiffPipelineConfig(t *testing.T) {
+	testCases := []struct {
+		name            string
+		renderedConfig  string
+		expectedChanges []PipelineChange
+	}{
+		{
+			name: "unchanged",
+			renderedConfig: `
+resources:
+- name: repo
+  type: git
+  source:
+    uri: https://github.com/mweagle/SpartaCICD.git
+    branch: master
+- name: artifacts
+  type: s3
+  source:
+    bucket: weyland
+    access_key_id: AKIAOLD
+    secret_access_key: old
+- name: nightly
+  type: time
+  source:
+    interval: 24h
+jobs:
+- name: build
+  plan:
+  - get: repo
+    trigger: true
+- name: deploy
+  serial: true
+  plan:
+  - get: repo
+`,
+		},
+		{
+			name: "added, removed and changed",
+			renderedConfig: `
+resources:
+- name: repo
+  type: git
+  source:
+    uri: https://github.com/mweagle/SpartaCICD.git
+    branch: develop
+- name: artifacts
+  type: s3
+  source:
+    bucket: weyland
+    access_key_id: AKIAOLD
+    secret_access_key: old
+- name: version
+  type: semver
+jobs:
+- name: build
+  plan:
+  - get: repo
+    trigger: true
+- name: deploy
+  plan:
+  - get: repo
+- name: test
+  plan:
+  - get: repo
+`,
+			expectedChanges: []PipelineChange{
+				{Section: "resources", Name: "repo", Kind: PipelineChangeChanged, Fields: []string{"source"}},
+				{Section: "resources", Name: "version", Kind: PipelineChangeAdded},
+				{Section: "resources", Name: "nightly", Kind: PipelineChangeRemoved},
+				{Section: "jobs", Name: "deploy", Kind: PipelineChangeChanged, Fields: []string{"serial"}},
+				{Section: "jobs", Name: "test", Kind: PipelineChangeAdded},
+			},
+		},
+	}
+	for _, eachCase := range testCases {
+		changes, changesErr := diffPipelineConfig([]byte(eachCase.renderedConfig),
+			json.RawMessage(testDeployedConfig))
+		if nil != changesErr {
+			t.Fatalf("%s: %s", eachCase.name, changesErr)
+		}
+		if !reflect.DeepEqual(changes, eachCase.expectedChanges) {
+			t.Fatalf("%s: unexpected changes: %#v", eachCase.name, changes)
+		}
+	}
+}
+
+func TestDiffPipelineConfigVolatilePlaceholder(t *testing.T) {
+	planVars := planCredentialVars(map[string]interface{}{
+		"access-key-id":     "AKIANEW",
+		"secret-access-key": "new",
+		"bucket":            "weyland",
+	})
+	if planVars["access-key-id"] != volatileVarPlaceholder ||
+		planVars["secret-access-key"] != volatileVarPlaceholder ||
+		planVars["bucket"] != "weyland" {
+		t.Fatalf("Unexpected plan vars: %#v", planVars)
+	}
+	if _, exists := planVars["session-token"]; exists {
+		t.Fatalf("Unexpected session-token placeholder: %#v", planVars)
+	}
+
+	testCases := []struct {
+		name            string
+		source          string
+		expectedChanges []PipelineChange
+	}{
+		{
+			name: "placeholder only",
+			source: `
+    bucket: weyland
+    access_key_id: ` + volatileVarPlaceholder + `
+    secret_access_key: ` + volatileVarPlaceholder,
+		},
+		{
+			name: "placeholder with surrounding text",
+			source: `
+    bucket: weyland
+    access_key_id: AKIA` + volatileVarPlaceholder + `
+    secret_access_key: ` + volatileVarPlaceholder,
+		},
+		{
+			name: "placeholder with other surrounding text",
+			source: `
+    bucket: weyland
+    access_key_id: ASIA` + volatileVarPlaceholder + `
+    secret_access_key: ` + volatileVarPlaceholder,
+			expectedChanges: []PipelineChange{
+				{Section: "resources", Name: "artifacts", Kind: PipelineChangeChanged, Fields: []string{"source"}},
+			},
+		},
+		{
+			name: "placeholder and another change",
+			source: `
+    bucket: yutani
+    access_key_id: ` + volatileVarPlaceholder + `
+    secret_access_key: ` + volatileVarPlaceholder,
+			expectedChanges: []PipelineChange{
+				{Section: "resources", Name: "artifacts", Kind: PipelineChangeChanged, Fields: []string{"source"}},
+			},
+		},
+	}
+	deployedConfig := json.RawMessage(`{
+		"resources": [
+			{"name": "artifacts", "type": "s3", "source": {"bucket": "weyland", "access_key_id": "AKIAOLD", "secret_access_key": "old"}}
+		]
+	}`)
+	for _, eachCase := range testCases {
+		renderedConfig := `
+resources:
+- name: artifacts
+  type: s3
+  source:` + eachCase.source + "\n"
+		changes, changesErr := diffPipelineConfig([]byte(renderedConfig), deployedConfig)
+		if nil != changesErr {
+			t.Fatalf("%s: %s", eachCase.name, changesErr)
+		}
+		if !reflect.DeepEqual(changes, eachCase.expectedChanges) {
+			t.Fatalf("%s: unexpected changes: %#v", eachCase.name, changes)
+		}
+	}
+}
+
+func TestPipelineDiffsExitCode(t *testing.T) {
+	unchanged := PipelineDiff{Name: "build"}
+	created := PipelineDiff{Name: "deploy", Created: true}
+	changed := PipelineDiff{
+		Name: "test",
+		Changes: []PipelineChange{
+			{Section: "jobs", Name: "test", Kind: PipelineChangeAdded},
+		},
+	}
+	testCases := []struct {
+		diffs            []PipelineDiff
+		expectedExitCode int
+	}{
+		{nil, 0},
+		{[]PipelineDiff{unchanged}, 0},
+		{[]PipelineDiff{unchanged, created}, PipelineDiffExitCode},
+		{[]PipelineDiff{changed, unchanged}, PipelineDiffExitCode},
+	}
+	for _, eachCase := range testCases {
+		exitCode := PipelineDiffsExitCode(eachCase.diffs)
+		if exitCode != eachCase.expectedExitCode {
+			t.Fatalf("Expected exit code %d for %#v, got %d",
+				eachCase.expectedExitCode,
+				eachCase.diffs,
+				exitCode)
+		}
+	}
+	if PipelineDiffExitCode != 2 {
+		t.Fatalf("The pipeline-diff exit code changed: %d", PipelineDiffExitCode)
+	}
+
+	var output bytes.Buffer
+	WritePipelineDiffs(&output, []PipelineDiff{unchanged, created, changed})
+	for _, eachLine := range []string{
+		"pipeline build: no changes",
+		"pipeline deploy: + new pipeline",
+		"  + jobs/test",
+		"2 of 3 pipelines have changes",
+	} {
+		if !strings.Contains(output.String(), eachLine) {
+			t.Fatalf("Expected the output to include %q: %s", eachLine, output.String())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package concourse
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// managedPipelinesState is the state file written when removed pipelines
+// are destroyed. It records the pipelines set by SyncIt s.t. pipelines
+// removed from the repo while the process wasn't running are destroyed
+// after it restarts.
+type managedPipelinesState struct {
+	Pipelines []string `json:"pipelines"`
+}
+
+// Return the pipeline names saved in the state file. A missing file is
+// an empty set.
+func loadManagedPipelines(statePath string) ([]string, error) {
+	contents, contentsErr := ioutil.ReadFile(statePath)
+	if os.IsNotExist(contentsErr) {
+		return nil, nil
+	}
+	if nil != contentsErr {
+		return nil, contentsErr
+	}
+	var state managedPipelinesState
+	decodeErr := json.Unmarshal(contents, &state)
+	if nil != decodeErr {
+		return nil, decodeErr
+	}
+	return state.Pipelines, nil
+}
+
+// Save the names of the applied pipelines to the state file
+func saveManagedPipelines(statePath string, appliedPipelines map[string]appliedPipeline) error {
+	state := managedPipelinesState{
+		Pipelines: []string{},
+	}
+	for eachName := range appliedPipelines {
+		state.Pipelines = append(state.Pipelines, eachName)
+	}
+	sort.Strings(state.Pipelines)
+	contents, contentsErr := json.Marshal(state)
+	if nil != contentsErr {
+		return contentsErr
+	}
+	// Write to a temp file in the same directory and rename it s.t. the
+	// state is never partially written
+	tempFile, tempFileErr := ioutil.TempFile(filepath.Dir(statePath), "."+filepath.Base(statePath))
+	if nil != tempFileErr {
+		return tempFileErr
+	}
+	_, writeErr := tempFile.Write(contents)
+	closeErr := tempFile.Close()
+	if nil == writeErr {
+		writeErr = closeErr
+	}
+	if nil == writeErr {
+		writeErr = os.Rename(tempFile.Name(), statePath)
+	}
+	if nil != writeErr {
+		os.Remove(tempFile.Name())
+	}
+	return writeErr
+}
@@ -0,0 +1,58 @@
+package concourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches the {{var-name}} placeholders that fly set-pipeline replaces
+// with the values loaded via -l
+var pipelineVarRegexp = regexp.MustCompile(`\{\{([-\w\p{L}]+)\}\}`)
+
+// Matches the ((var-name)) placeholders that are resolved by either
+// fly set-pipeline -l or a Concourse credential manager
+var credentialManagerVarRegexp = regexp.MustCompile(`\(\(([-\w\p{L}]+)\)\)`)
+
+// Replace the {{var-name}} placeholders in the pipeline config with the
+// JSON encoded value of the corresponding var. If interpolateParenVars is
+// true, ((var-name)) placeholders are replaced as well. Otherwise they're
+// left for the Concourse credential manager. Every replaced placeholder
+// must have a value.
+func renderPipelineConfig(config []byte,
+	vars map[string]interface{},
+	interpolateParenVars bool) ([]byte, error) {
+	missingVars := make(map[string]bool)
+	replacer := func(varRegexp *regexp.Regexp) func([]byte) []byte {
+		return func(match []byte) []byte {
+			varName := string(varRegexp.FindSubmatch(match)[1])
+			value, exists := vars[varName]
+			if !exists {
+				missingVars[varName] = true
+				return match
+			}
+			encoded, encodedErr := json.Marshal(value)
+			if nil != encodedErr {
+				missingVars[varName] = true
+				return match
+			}
+			return encoded
+		}
+	}
+	rendered := pipelineVarRegexp.ReplaceAllFunc(config, replacer(pipelineVarRegexp))
+	if interpolateParenVars {
+		rendered = credentialManagerVarRegexp.ReplaceAllFunc(rendered,
+			replacer(credentialManagerVarRegexp))
+	}
+	if len(missingVars) != 0 {
+		var names []string
+		for eachName := range missingVars {
+			names = append(names, eachName)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unresolved pipeline vars: %s", strings.Join(names, ", "))
+	}
+	return rendered, nil
+}
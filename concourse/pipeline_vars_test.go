@@ -0,0 +1,76 @@
+package concourse
+
+import (
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// staticProvider returns fixed credentials
+type staticProvider struct {
+	creds AWSCredentials
+}
+
+func (provider *staticProvider) Retrieve() (*AWSCredentials, error) {
+	creds := provider.creds
+	return &creds, nil
+}
+
+// Return the sorted var names used by the pipeline config
+func pipelineVarNames(config []byte) []string {
+	names := make(map[string]bool)
+	for _, eachRegexp := range []*regexp.Regexp{pipelineVarRegexp, credentialManagerVarRegexp} {
+		for _, eachMatch := range eachRegexp.FindAllSubmatch(config, -1) {
+			names[string(eachMatch[1])] = true
+		}
+	}
+	var sortedNames []string
+	for eachName := range names {
+		sortedNames = append(sortedNames, eachName)
+	}
+	sort.Strings(sortedNames)
+	return sortedNames
+}
+
+func TestCredentialVarsMatchPipeline(t *testing.T) {
+	config, configErr := ioutil.ReadFile("../pipeline.yml")
+	if nil != configErr {
+		t.Fatal(configErr)
+	}
+	ctx := &workflowContext{
+		logger:    logrus.New(),
+		awsRegion: "us-west-2",
+		s3Bucket:  "artifacts",
+		credentialProvider: &staticProvider{
+			creds: AWSCredentials{
+				AccessKeyID:     "AKID",
+				SecretAccessKey: "SECRET",
+				SessionToken:    "TOKEN",
+			},
+		},
+		credentialStore: &inlineCredentialStore{},
+		state: &syncState{
+			appliedPipelines: make(map[string]appliedPipeline),
+		},
+	}
+	_, refreshErr := refreshCredentials(ctx)
+	if nil != refreshErr {
+		t.Fatal(refreshErr)
+	}
+	varNames := pipelineVarNames(config)
+	if len(varNames) != len(ctx.credentialVars) {
+		t.Fatalf("pipeline.yml uses %v, sync provides %v", varNames, sortedVarNames(ctx.credentialVars))
+	}
+	for _, eachName := range varNames {
+		if _, exists := ctx.credentialVars[eachName]; !exists {
+			t.Fatalf("pipeline.yml uses %s, sync provides %v", eachName, sortedVarNames(ctx.credentialVars))
+		}
+	}
+	_, renderErr := renderPipelineConfig(config, ctx.credentialVars, true)
+	if nil != renderErr {
+		t.Fatal(renderErr)
+	}
+}
@@ -0,0 +1,188 @@
+package concourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"path"
+	"time"
+)
+
+// Version is the SpartaCICD version reported by the sync status and the
+// control plane. Set it at build time with -ldflags
+// "-X github.com/mweagle/SpartaCICD/concourse.Version=1.2.3". The Makefile
+// sets it to the `git describe` output.
+var Version = "dev"
+
+const (
+	statusParameterName      = "sync-status"
+	syncRequestParameterName = "sync-request"
+	// How often the sync loop checks for control plane sync requests
+	syncRequestPollInterval = 30 * time.Second
+)
+
+// PipelineStatus is the sync outcome for a single pipeline
+type PipelineStatus struct {
+	Name      string `json:"name"`
+	Path      string `json:"path,omitempty"`
+	Destroyed bool   `json:"destroyed,omitempty"`
+	Unchanged bool   `json:"unchanged,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SyncStatus is the outcome of the most recent sync, which is published
+// for the control plane
+type SyncStatus struct {
+	// ConcourseURL is the external URL of the synced Concourse
+	ConcourseURL string           `json:"concourseURL"`
+	TeamName     string           `json:"teamName"`
+	Version      string           `json:"version"`
+	CommitSHA    string           `json:"commitSHA,omitempty"`
+	Time         time.Time        `json:"time"`
+	Error        string           `json:"error,omitempty"`
+	Pipelines    []PipelineStatus `json:"pipelines"`
+}
+
+// StatusStore publishes the sync status and relays sync requests from the
+// control plane to the sync loop
+type StatusStore interface {
+	PutStatus(status *SyncStatus) error
+	// Status returns nil if no sync has completed
+	Status() (*SyncStatus, error)
+	RequestSync(reason string) error
+	// SyncRequest returns the most recent sync request, or the empty
+	// string if none has been made
+	SyncRequest() (string, error)
+}
+
+// Return the status of the sync described by ctx
+func newSyncStatus(ctx *workflowContext, externalURL string) *SyncStatus {
+	status := &SyncStatus{
+		ConcourseURL: externalURL,
+		TeamName:     ctx.teamName,
+		Version:      Version,
+		CommitSHA:    ctx.commitSHA,
+		Time:         time.Now().UTC(),
+		Pipelines:    []PipelineStatus{},
+	}
+	if nil != ctx.syncErr {
+		status.Error = ctx.syncErr.Error()
+	}
+	for _, eachResult := range ctx.results {
+		pipelineStatus := PipelineStatus{
+			Name:      eachResult.Name,
+			Path:      eachResult.Path,
+			Destroyed: eachResult.Destroyed,
+			Unchanged: eachResult.Unchanged,
+		}
+		if nil != eachResult.Err {
+			pipelineStatus.Error = eachResult.Err.Error()
+		}
+		status.Pipelines = append(status.Pipelines, pipelineStatus)
+	}
+	return status
+}
+
+// Request a sync whenever the control plane records a new sync request
+func pollSyncRequests(statusStore StatusStore, triggers chan<- string, logger *logrus.Logger) {
+	lastRequest, lastRequestErr := statusStore.SyncRequest()
+	if nil != lastRequestErr {
+		logger.WithFields(logrus.Fields{
+			"Error": lastRequestErr,
+		}).Warn("Failed to read sync request")
+	}
+	for range time.Tick(syncRequestPollInterval) {
+		request, requestErr := statusStore.SyncRequest()
+		if nil != requestErr {
+			logger.WithFields(logrus.Fields{
+				"Error": requestErr,
+			}).Warn("Failed to read sync request")
+			continue
+		}
+		if "" == request || request == lastRequest {
+			continue
+		}
+		lastRequest = request
+		select {
+		case triggers <- fmt.Sprintf("Control plane request: %s", request):
+		default:
+			logger.Debug("Sync already pending")
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SSM Parameter Store
+
+// SSMStatusStore saves the sync status and sync requests as SSM parameters
+// under Prefix
+type SSMStatusStore struct {
+	Region string
+	Prefix string
+}
+
+func (statusStore *SSMStatusStore) svc() *ssm.SSM {
+	return ssm.New(session.New(aws.NewConfig().WithRegion(statusStore.Region)))
+}
+
+func (statusStore *SSMStatusStore) put(name string, value string) error {
+	_, putErr := statusStore.svc().PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(path.Join("/", statusStore.Prefix, name)),
+		Value:     aws.String(value),
+		Type:      aws.String(ssm.ParameterTypeString),
+		Overwrite: aws.Bool(true),
+	})
+	return putErr
+}
+
+// Return the parameter value, or the empty string if it doesn't exist
+func (statusStore *SSMStatusStore) get(name string) (string, error) {
+	getOutput, getErr := statusStore.svc().GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(path.Join("/", statusStore.Prefix, name)),
+	})
+	if awsErr, ok := getErr.(awserr.Error); ok && awsErr.Code() == ssm.ErrCodeParameterNotFound {
+		return "", nil
+	}
+	if nil != getErr {
+		return "", getErr
+	}
+	return aws.StringValue(getOutput.Parameter.Value), nil
+}
+
+// PutStatus saves the status
+func (statusStore *SSMStatusStore) PutStatus(status *SyncStatus) error {
+	statusJSON, statusJSONErr := json.Marshal(status)
+	if nil != statusJSONErr {
+		return statusJSONErr
+	}
+	return statusStore.put(statusParameterName, string(statusJSON))
+}
+
+// Status returns the saved status
+func (statusStore *SSMStatusStore) Status() (*SyncStatus, error) {
+	statusJSON, statusJSONErr := statusStore.get(statusParameterName)
+	if nil != statusJSONErr || "" == statusJSON {
+		return nil, statusJSONErr
+	}
+	var status SyncStatus
+	decodeErr := json.Unmarshal([]byte(statusJSON), &status)
+	if nil != decodeErr {
+		return nil, decodeErr
+	}
+	return &status, nil
+}
+
+// RequestSync records a sync request. Each request has a unique value.
+func (statusStore *SSMStatusStore) RequestSync(reason string) error {
+	return statusStore.put(syncRequestParameterName,
+		fmt.Sprintf("%s %s", time.Now().UTC().Format(time.RFC3339Nano), reason))
+}
+
+// SyncRequest returns the most recent sync request
+func (statusStore *SSMStatusStore) SyncRequest() (string, error) {
+	return statusStore.get(syncRequestParameterName)
+}
@@ -0,0 +1,207 @@
+package concourse
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"hash"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	webhookPath          = "/webhook"
+	maxWebhookBodyLength = 5 * 1024 * 1024
+	// Bound slow or idle clients s.t. they can't exhaust the listener
+	webhookReadTimeout  = 30 * time.Second
+	webhookWriteTimeout = 30 * time.Second
+	webhookIdleTimeout  = 120 * time.Second
+)
+
+// pushEvent includes the GitHub and GitLab push payload fields used to
+// match the configured repo and branch
+// Ref: https://developer.github.com/v3/activity/events/types/#pushevent
+// Ref: https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#push-events
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL   string `json:"clone_url"`
+		HTMLURL    string `json:"html_url"`
+		SSHURL     string `json:"ssh_url"`
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		Homepage   string `json:"homepage"`
+	} `json:"repository"`
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+}
+
+// Return the repo URLs included in the push event
+func (event *pushEvent) repoURLs() []string {
+	return []string{
+		event.Repository.CloneURL,
+		event.Repository.HTMLURL,
+		event.Repository.SSHURL,
+		event.Repository.GitHTTPURL,
+		event.Repository.GitSSHURL,
+		event.Repository.Homepage,
+		event.Project.GitHTTPURL,
+		event.Project.GitSSHURL,
+		event.Project.WebURL,
+	}
+}
+
+// Normalize a repo URL s.t. the clone and web URLs compare equal
+func normalizeRepoURL(repoURL string) string {
+	normalized := strings.ToLower(strings.TrimSpace(repoURL))
+	normalized = strings.TrimSuffix(normalized, "/")
+	return strings.TrimSuffix(normalized, ".git")
+}
+
+// webhookHandler verifies push webhooks and requests a sync for pushes
+// to the configured repo and branch
+type webhookHandler struct {
+	repoURL  string
+	branch   string
+	secret   string
+	triggers chan<- string
+	logger   *logrus.Logger
+}
+
+// Verify the GitHub HMAC signature or the GitLab token
+func (handler *webhookHandler) verify(req *http.Request, body []byte) error {
+	if gitlabToken := req.Header.Get("X-Gitlab-Token"); "" != gitlabToken {
+		if subtle.ConstantTimeCompare([]byte(gitlabToken), []byte(handler.secret)) != 1 {
+			return fmt.Errorf("Invalid X-Gitlab-Token")
+		}
+		return nil
+	}
+	var hashFactory func() hash.Hash
+	signature := req.Header.Get("X-Hub-Signature-256")
+	if "" != signature {
+		hashFactory = sha256.New
+		signature = strings.TrimPrefix(signature, "sha256=")
+	} else if signature = req.Header.Get("X-Hub-Signature"); "" != signature {
+		hashFactory = sha1.New
+		signature = strings.TrimPrefix(signature, "sha1=")
+	} else {
+		return fmt.Errorf("Missing webhook signature")
+	}
+	expectedSignature, expectedSignatureErr := hex.DecodeString(signature)
+	if nil != expectedSignatureErr {
+		return fmt.Errorf("Malformed webhook signature: %s", expectedSignatureErr.Error())
+	}
+	mac := hmac.New(hashFactory, []byte(handler.secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expectedSignature) {
+		return fmt.Errorf("Invalid webhook signature")
+	}
+	return nil
+}
+
+// Request a sync. If one is already pending the request is coalesced
+// with it.
+func (handler *webhookHandler) trigger(reason string) {
+	select {
+	case handler.triggers <- reason:
+	default:
+		handler.logger.Debug("Sync already pending")
+	}
+}
+
+func (handler *webhookHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, bodyErr := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookBodyLength))
+	if nil != bodyErr {
+		http.Error(w, bodyErr.Error(), http.StatusBadRequest)
+		return
+	}
+	verifyErr := handler.verify(req, body)
+	if nil != verifyErr {
+		handler.logger.WithFields(logrus.Fields{
+			"RemoteAddr": req.RemoteAddr,
+			"Error":      verifyErr,
+		}).Warn("Rejected webhook")
+		http.Error(w, verifyErr.Error(), http.StatusUnauthorized)
+		return
+	}
+	eventType := firstNonEmpty(req.Header.Get("X-GitHub-Event"), req.Header.Get("X-Gitlab-Event"))
+	if eventType != "push" && eventType != "Push Hook" {
+		fmt.Fprintf(w, "Ignored %s event", eventType)
+		return
+	}
+	var event pushEvent
+	decodeErr := json.Unmarshal(body, &event)
+	if nil != decodeErr {
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+	repoMatch := false
+	for _, eachURL := range event.repoURLs() {
+		if "" != eachURL && normalizeRepoURL(eachURL) == normalizeRepoURL(handler.repoURL) {
+			repoMatch = true
+			break
+		}
+	}
+	if !repoMatch || event.Ref != fmt.Sprintf("refs/heads/%s", handler.branch) {
+		handler.logger.WithFields(logrus.Fields{
+			"Ref": event.Ref,
+		}).Debug("Ignoring push for another repo or branch")
+		fmt.Fprint(w, "Ignored push")
+		return
+	}
+	handler.trigger(fmt.Sprintf("%s push to %s", eventType, event.Ref))
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprint(w, "Sync triggered")
+}
+
+// Start the webhook listener that requests syncs via the triggers channel
+func listenForWebhooks(options *SyncOptions, triggers chan<- string, logger *logrus.Logger) error {
+	if "" == options.WebhookSecret {
+		return fmt.Errorf("A webhook secret is required to enable the webhook listener")
+	}
+	listener, listenerErr := net.Listen("tcp", options.WebhookAddress)
+	if nil != listenerErr {
+		return listenerErr
+	}
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath, &webhookHandler{
+		repoURL:  options.RepoURL,
+		branch:   options.Branch,
+		secret:   options.WebhookSecret,
+		triggers: triggers,
+		logger:   logger,
+	})
+	logger.WithFields(logrus.Fields{
+		"Address": listener.Addr().String(),
+		"Path":    webhookPath,
+	}).Info("Listening for webhooks")
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: webhookReadTimeout,
+		ReadTimeout:       webhookReadTimeout,
+		WriteTimeout:      webhookWriteTimeout,
+		IdleTimeout:       webhookIdleTimeout,
+	}
+	go func() {
+		serveErr := server.Serve(listener)
+		logger.WithFields(logrus.Fields{
+			"Error": serveErr,
+		}).Error("Webhook listener stopped")
+	}()
+	return nil
+}
@@ -0,0 +1,226 @@
+package concourse
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	testWebhookSecret  = "tea-earl-grey-hot"
+	testWebhookRepoURL = "https://github.com/mweagle/SpartaCICD.git"
+)
+
+// Return the hex encoded HMAC of the body
+func webhookSignature(hashFactory func() hash.Hash, body string) string {
+	mac := hmac.New(hashFactory, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Return a webhook handler for the test repo's master branch
+func newTestWebhookHandler(triggers chan<- string) *webhookHandler {
+	return &webhookHandler{
+		repoURL:  testWebhookRepoURL,
+		branch:   "master",
+		secret:   testWebhookSecret,
+		triggers: triggers,
+		logger:   logrus.New(),
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	githubPush := `{"ref":"refs/heads/master","repository":{"clone_url":"https://github.com/mweagle/SpartaCICD.git"}}`
+	gitlabPush := `{"ref":"refs/heads/master","project":{"web_url":"https://github.com/mweagle/SpartaCICD"}}`
+	otherRepoPush := `{"ref":"refs/heads/master","repository":{"clone_url":"https://github.com/mweagle/Sparta.git"}}`
+	otherBranchPush := `{"ref":"refs/heads/develop","repository":{"clone_url":"https://github.com/mweagle/SpartaCICD.git"}}`
+
+	testCases := []struct {
+		name          string
+		method        string
+		headers       map[string]string
+		body          string
+		expectedCode  int
+		expectTrigger bool
+	}{
+		{
+			name:   "sha256 signature",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + webhookSignature(sha256.New, githubPush),
+			},
+			body:          githubPush,
+			expectedCode:  http.StatusAccepted,
+			expectTrigger: true,
+		},
+		{
+			name:   "sha1 signature",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":  "push",
+				"X-Hub-Signature": "sha1=" + webhookSignature(sha1.New, githubPush),
+			},
+			body:          githubPush,
+			expectedCode:  http.StatusAccepted,
+			expectTrigger: true,
+		},
+		{
+			name:   "sha256 signature of another body",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + webhookSignature(sha256.New, otherBranchPush),
+			},
+			body:         githubPush,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "sha1 signature with the sha256 header",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + webhookSignature(sha1.New, githubPush),
+			},
+			body:         githubPush,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "malformed signature",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=engage",
+			},
+			body:         githubPush,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "missing signature",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event": "push",
+			},
+			body:         githubPush,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "GitLab token",
+			method: "POST",
+			headers: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": testWebhookSecret,
+			},
+			body:          gitlabPush,
+			expectedCode:  http.StatusAccepted,
+			expectTrigger: true,
+		},
+		{
+			name:   "invalid GitLab token",
+			method: "POST",
+			headers: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": testWebhookSecret + "-suffix",
+			},
+			body:         gitlabPush,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "another repo",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + webhookSignature(sha256.New, otherRepoPush),
+			},
+			body:         otherRepoPush,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "another branch",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": "sha256=" + webhookSignature(sha256.New, otherBranchPush),
+			},
+			body:         otherBranchPush,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "another event",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event":      "ping",
+				"X-Hub-Signature-256": "sha256=" + webhookSignature(sha256.New, githubPush),
+			},
+			body:         githubPush,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "GET",
+			method:       "GET",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "oversized body",
+			method: "POST",
+			headers: map[string]string{
+				"X-GitHub-Event": "push",
+			},
+			body:         strings.Repeat(" ", maxWebhookBodyLength+1),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, eachCase := range testCases {
+		triggers := make(chan string, 1)
+		req := httptest.NewRequest(eachCase.method, webhookPath, strings.NewReader(eachCase.body))
+		for eachHeader, eachValue := range eachCase.headers {
+			req.Header.Set(eachHeader, eachValue)
+		}
+		recorder := httptest.NewRecorder()
+		newTestWebhookHandler(triggers).ServeHTTP(recorder, req)
+		if recorder.Code != eachCase.expectedCode {
+			t.Fatalf("%s: expected %d, got %d: %s",
+				eachCase.name,
+				eachCase.expectedCode,
+				recorder.Code,
+				recorder.Body.String())
+		}
+		if (len(triggers) == 1) != eachCase.expectTrigger {
+			t.Fatalf("%s: unexpected sync triggers: %d", eachCase.name, len(triggers))
+		}
+	}
+}
+
+func TestWebhookTriggerDoesNotBlock(t *testing.T) {
+	// An unbuffered channel without a receiver blocks unless the trigger is
+	// coalesced with the pending sync
+	triggers := make(chan string)
+	body := `{"ref":"refs/heads/master","repository":{"clone_url":"https://github.com/mweagle/SpartaCICD.git"}}`
+	req := httptest.NewRequest("POST", webhookPath, strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+webhookSignature(sha256.New, body))
+	recorder := httptest.NewRecorder()
+
+	served := make(chan struct{})
+	go func() {
+		newTestWebhookHandler(triggers).ServeHTTP(recorder, req)
+		close(served)
+	}()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The webhook handler blocked on the pending sync")
+	}
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status code: %d", recorder.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultConcourseVersion = "v1.3.0-rc.73"
+)
+
+var concourseVersionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+[-.\w]*$`)
+var sha256Pattern = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
+// Verify the Concourse binary options
+func validateConcourseReleaseOptions() error {
+	if !concourseVersionPattern.MatchString(options.ConcourseVersion) {
+		return fmt.Errorf("Invalid --concourse-version value: %s", options.ConcourseVersion)
+	}
+	if "" != options.ConcourseSHA256 && !sha256Pattern.MatchString(options.ConcourseSHA256) {
+		return fmt.Errorf("Invalid --concourse-sha256 value: %s", options.ConcourseSHA256)
+	}
+	if "" != options.ConcourseS3URL {
+		_, _, s3URLErr := parseS3URL(options.ConcourseS3URL)
+		return s3URLErr
+	}
+	return nil
+}
+
+// Split an s3://bucket/key URL
+func parseS3URL(s3URL string) (string, string, error) {
+	bucketKey := strings.SplitN(strings.TrimPrefix(s3URL, "s3://"), "/", 2)
+	if !strings.HasPrefix(s3URL, "s3://") ||
+		len(bucketKey) != 2 ||
+		"" == bucketKey[0] ||
+		"" == bucketKey[1] {
+		return "", "", fmt.Errorf("Invalid S3 URL (expected s3://bucket/key): %s", s3URL)
+	}
+	return bucketKey[0], bucketKey[1], nil
+}
+
+// Return the userdata properties that select and verify the Concourse binary
+func concourseReleaseUserDataProps() map[string]interface{} {
+	return map[string]interface{}{
+		"ConcourseVersion": options.ConcourseVersion,
+		"ConcourseSHA256":  strings.ToLower(options.ConcourseSHA256),
+		"ConcourseS3URL":   options.ConcourseS3URL,
+	}
+}
+
+// Return the statement that allows an instance to download the Concourse
+// binary from S3, or nil if it's downloaded from GitHub
+func concourseReleaseStatement() *spartaIAM.PolicyStatement {
+	bucket, key, s3URLErr := parseS3URL(options.ConcourseS3URL)
+	if nil != s3URLErr {
+		return nil
+	}
+	return &spartaIAM.PolicyStatement{
+		Effect:   "Allow",
+		Action:   []string{"s3:GetObject"},
+		Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s/%s", bucket, key)),
+	}
+}
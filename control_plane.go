@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	gocf "github.com/crewjam/go-cloudformation"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/SpartaCICD/concourse"
+	"os"
+)
+
+const (
+	spartaCICDServiceName = "SpartaCICD"
+	// API Gateway resource for the control plane
+	controlPlaneResourcePath = "/control"
+)
+
+// controlPlaneSecret is the control plane configuration saved in
+// Secrets Manager. The password is empty until the web node boots.
+type controlPlaneSecret struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	APIToken string `json:"apiToken"`
+}
+
+// Suffix of the stack name that names the Secrets Manager secret with the
+// control plane configuration s.t. each stack has its own secret
+const controlPlaneSecretSuffix = "/control-plane"
+
+// Return the name of the Secrets Manager secret with the control plane
+// configuration
+func controlPlaneSecretName(stackName string) string {
+	return stackName + controlPlaneSecretSuffix
+}
+
+// Return the SSM parameter prefix where the sync status is published
+func statusParameterPrefix(stackName string) string {
+	return fmt.Sprintf("/%s", stackName)
+}
+
+// Key of the generated API token in the control plane secret
+const controlPlaneAPITokenKey = "apiToken"
+
+// controlPlaneSecretResource describes the control plane secret resource
+type controlPlaneSecretResource struct {
+	// Secret ARN the EC2 instance is allowed to update
+	secretARN *gocf.StringExpr
+	// Secret ID expanded into the userdata, which adds the basic auth
+	// credentials at boot
+	userDataSecretID string
+}
+
+// Add the secret with the control plane configuration. CloudFormation
+// generates the API token and the web node adds the basic auth password at
+// boot, s.t. neither is included in the template.
+func addControlPlaneResources(template *gocf.Template) *controlPlaneSecretResource {
+	secretResourceName := sparta.CloudFormationResourceName("ControlPlaneSecret",
+		"ControlPlaneSecret")
+	template.AddResource(secretResourceName, &secretsManagerSecret{
+		Name: gocf.Join("",
+			gocf.Ref("AWS::StackName").String(),
+			gocf.String(controlPlaneSecretSuffix)),
+		Description: gocf.String("SpartaCICD control plane configuration"),
+		GenerateSecretString: &secretsManagerGenerateSecretString{
+			SecretStringTemplate: gocf.String(fmt.Sprintf(`{"username":"%s"}`, options.Username)),
+			GenerateStringKey:    gocf.String(controlPlaneAPITokenKey),
+			PasswordLength:       gocf.Integer(40),
+			ExcludePunctuation:   gocf.Bool(true),
+		},
+	})
+	return &controlPlaneSecretResource{
+		secretARN:        gocf.Ref(secretResourceName).String(),
+		userDataSecretID: fmt.Sprintf(`{ "Ref" : "%s" }`, secretResourceName),
+	}
+}
+
+// Return an ARN for a resource named after the stack in the stack's region
+// and account
+func stackNamedARN(service string, resourcePrefix string, resourceSuffix string) *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String(fmt.Sprintf("arn:aws:%s:", service)),
+		gocf.Ref("AWS::Region").String(),
+		gocf.String(":"),
+		gocf.Ref("AWS::AccountId").String(),
+		gocf.String(":"+resourcePrefix),
+		gocf.Ref("AWS::StackName").String(),
+		gocf.String(resourceSuffix))
+}
+
+// Return the control plane Lambda IAM privileges
+func controlPlanePrivileges() []sparta.IAMRolePrivilege {
+	return []sparta.IAMRolePrivilege{
+		sparta.IAMRolePrivilege{
+			Actions:  []string{"secretsmanager:GetSecretValue"},
+			Resource: stackNamedARN("secretsmanager", "secret:", controlPlaneSecretSuffix+"-*"),
+		},
+		sparta.IAMRolePrivilege{
+			Actions:  []string{"ssm:GetParameter", "ssm:PutParameter"},
+			Resource: stackNamedARN("ssm", "parameter/", "/*"),
+		},
+	}
+}
+
+// Return the name of the stack that the control plane Lambda belongs to
+func discoverStackName() (string, error) {
+	configuration, configurationErr := sparta.Discover()
+	if nil != configurationErr {
+		return "", configurationErr
+	}
+	stackName, _ := configuration["StackName"].(string)
+	if "" == stackName {
+		return "", fmt.Errorf("Failed to discover the stack name: %#v", configuration)
+	}
+	return stackName, nil
+}
+
+// Return the control plane configured by the provision command
+func newControlPlane(stackName string) (*concourse.ControlPlane, error) {
+	region := os.Getenv("AWS_REGION")
+	secretsSvc := secretsmanager.New(session.New(aws.NewConfig().WithRegion(region)))
+	secretOutput, secretOutputErr := secretsSvc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(controlPlaneSecretName(stackName)),
+	})
+	if nil != secretOutputErr {
+		return nil, secretOutputErr
+	}
+	var secret controlPlaneSecret
+	decodeErr := json.Unmarshal([]byte(aws.StringValue(secretOutput.SecretString)), &secret)
+	if nil != decodeErr {
+		return nil, decodeErr
+	}
+	return &concourse.ControlPlane{
+		Status: &concourse.SSMStatusStore{
+			Region: region,
+			Prefix: statusParameterPrefix(stackName),
+		},
+		Username: secret.Username,
+		Password: secret.Password,
+		APIToken: secret.APIToken,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	gocf "github.com/crewjam/go-cloudformation"
+)
+
+func TestControlPlaneSecretExcludesCredentials(t *testing.T) {
+	savedOptions := options
+	defer func() {
+		options = savedOptions
+	}()
+	options = newTestProvisionOptions()
+	options.Username = "picard"
+	options.Password = "EngageWarpNine"
+
+	template := gocf.NewTemplate()
+	secret := addControlPlaneResources(template)
+	if nil == secret.secretARN || "" == secret.userDataSecretID {
+		t.Fatalf("Unexpected secret resource: %#v", secret)
+	}
+	templateJSON, templateJSONErr := json.Marshal(template)
+	if nil != templateJSONErr {
+		t.Fatal(templateJSONErr)
+	}
+	rendered := string(templateJSON)
+	if strings.Contains(rendered, options.Password) || strings.Contains(rendered, `"SecretString"`) {
+		t.Fatalf("The control plane credentials are included in the template: %s", rendered)
+	}
+	for _, eachFragment := range []string{
+		`{"Ref":"AWS::StackName"},"/control-plane"`,
+		`"GenerateStringKey":"apiToken"`,
+		`{\"username\":\"picard\"}`,
+	} {
+		if !strings.Contains(rendered, eachFragment) {
+			t.Fatalf("Expected the template to include %s: %s", eachFragment, rendered)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	sparta "github.com/mweagle/Sparta"
+	"strings"
+)
+
+// Sources of the RDS master password. The password is never included in
+// the template, which Sparta uploads to S3 - a NoEcho parameter's Default
+// isn't masked and Sparta can't pass parameter values.
+const (
+	dbPasswordSourceGenerated      = "generated"
+	dbPasswordSourceSecretsManager = "secretsmanager"
+)
+
+const (
+	// Key of the password in the secret's JSON SecretString
+	dbPasswordSecretKey = "password"
+)
+
+// secretsManagerSecret is the AWS::SecretsManager::Secret resource
+// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-resource-secretsmanager-secret.html
+type secretsManagerSecret struct {
+	Name                 *gocf.StringExpr                    `json:",omitempty"`
+	Description          *gocf.StringExpr                    `json:",omitempty"`
+	SecretString         *gocf.StringExpr                    `json:",omitempty"`
+	GenerateSecretString *secretsManagerGenerateSecretString `json:",omitempty"`
+}
+
+// CfnResourceType returns the CloudFormation resource type
+func (secret secretsManagerSecret) CfnResourceType() string {
+	return "AWS::SecretsManager::Secret"
+}
+
+// secretsManagerGenerateSecretString is the GenerateSecretString property
+// that has CloudFormation generate the secret value
+type secretsManagerGenerateSecretString struct {
+	SecretStringTemplate *gocf.StringExpr  `json:",omitempty"`
+	GenerateStringKey    *gocf.StringExpr  `json:",omitempty"`
+	PasswordLength       *gocf.IntegerExpr `json:",omitempty"`
+	ExcludePunctuation   *gocf.BoolExpr    `json:",omitempty"`
+}
+
+// dbPassword describes where the RDS master password comes from
+type dbPassword struct {
+	// MasterUserPassword expression for the RDS instance
+	masterUserPassword *gocf.StringExpr
+	// Secret ARN the EC2 instance is allowed to read
+	secretARN *gocf.StringExpr
+	// Secret ID expanded into the userdata, which fetches the password
+	// at boot
+	userDataSecretID string
+}
+
+// Return the dynamic reference that resolves the password from the secret
+// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/dynamic-references.html
+func dbPasswordDynamicReference(secretID gocf.Stringable) *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String("{{resolve:secretsmanager:"),
+		secretID,
+		gocf.String(fmt.Sprintf(":SecretString:%s}}", dbPasswordSecretKey)))
+}
+
+// Add the template resources for the configured password source. The
+// password is never included in the template or the userdata.
+func addDBPasswordResources(template *gocf.Template) (*dbPassword, error) {
+	secretResourceName := sparta.CloudFormationResourceName("ConcourseDBPasswordSecret",
+		"ConcourseDBPasswordSecret")
+	secretTemplate := fmt.Sprintf(`{"username":"%s"}`, databaseMasterUsername)
+
+	switch options.DBPasswordSource {
+	case dbPasswordSourceGenerated:
+		template.AddResource(secretResourceName, &secretsManagerSecret{
+			Description: gocf.String("Concourse RDS master password"),
+			GenerateSecretString: &secretsManagerGenerateSecretString{
+				SecretStringTemplate: gocf.String(secretTemplate),
+				GenerateStringKey:    gocf.String(dbPasswordSecretKey),
+				PasswordLength:       gocf.Integer(32),
+				ExcludePunctuation:   gocf.Bool(true),
+			},
+		})
+		return &dbPassword{
+			masterUserPassword: dbPasswordDynamicReference(gocf.Ref(secretResourceName).String()),
+			secretARN:          gocf.Ref(secretResourceName).String(),
+			userDataSecretID:   fmt.Sprintf(`{ "Ref" : "%s" }`, secretResourceName),
+		}, nil
+	case dbPasswordSourceSecretsManager:
+		if "" == options.DBPasswordSecretID {
+			return nil, fmt.Errorf("--db-password-secret is required for the %s password source",
+				dbPasswordSourceSecretsManager)
+		}
+		secretARN := gocf.String(options.DBPasswordSecretID)
+		if !strings.HasPrefix(options.DBPasswordSecretID, "arn:") {
+			// Secret ARNs include a random suffix
+			secretARN = gocf.Join("",
+				gocf.String("arn:aws:secretsmanager:"),
+				gocf.Ref("AWS::Region").String(),
+				gocf.String(":"),
+				gocf.Ref("AWS::AccountId").String(),
+				gocf.String(fmt.Sprintf(":secret:%s-*", options.DBPasswordSecretID)))
+		}
+		return &dbPassword{
+			masterUserPassword: dbPasswordDynamicReference(gocf.String(options.DBPasswordSecretID)),
+			secretARN:          secretARN,
+			userDataSecretID:   options.DBPasswordSecretID,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported database password source: %s", options.DBPasswordSource)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	sparta "github.com/mweagle/Sparta"
+	"strings"
+)
+
+// concourseDNS describes the stable Route53 name for the Concourse endpoint
+type concourseDNS struct {
+	// Concourse --external-url value
+	externalURL string
+	// Arguments to `aws ec2 associate-address` s.t. the instance claims
+	// the Elastic IP at boot. Empty if the record aliases a load balancer.
+	associateAddressArgs string
+}
+
+// Returns true if a Route53 record should be created
+func isDNSEnabled() bool {
+	return "" != options.DomainName
+}
+
+// Verify the DNS options
+func validateDNSOptions() error {
+	if "" == options.HostedZoneID && "" == options.DomainName {
+		return nil
+	}
+	if "" == options.HostedZoneID || "" == options.DomainName {
+		return fmt.Errorf("--hosted-zone-id and --domain-name must be provided together")
+	}
+	// Each web node associates the Elastic IP at boot, taking it from the
+	// others
+	if loadBalancerNone == options.LoadBalancer && options.ASGMaxSize > 1 {
+		return fmt.Errorf("--domain-name without a load balancer requires --asg-max-size=1: %d",
+			options.ASGMaxSize)
+	}
+	return nil
+}
+
+// Add the Route53 record that points the domain name at the load balancer,
+// or at an Elastic IP if Concourse isn't fronted by a load balancer.
+// Returns nil if DNS isn't configured.
+func addDNSResources(template *gocf.Template, lb *loadBalancer) *concourseDNS {
+	if !isDNSEnabled() {
+		return nil
+	}
+	domainName := strings.TrimSuffix(options.DomainName, ".")
+	recordSetResourceName := sparta.CloudFormationResourceName("ConcourseRecordSet",
+		"ConcourseRecordSet")
+	recordSet := &gocf.Route53RecordSet{
+		HostedZoneId: gocf.String(options.HostedZoneID),
+		Name:         gocf.String(domainName + "."),
+		Type:         gocf.String("A"),
+	}
+	dns := &concourseDNS{}
+
+	if nil != lb {
+		recordSet.AliasTarget = &gocf.Route53AliasTarget{
+			DNSName:              lb.dnsName,
+			HostedZoneId:         lb.canonicalHostedZoneID,
+			EvaluateTargetHealth: gocf.Bool(false),
+		}
+		dns.externalURL = fmt.Sprintf("https://%s", domainName)
+	} else {
+		eipResourceName := sparta.CloudFormationResourceName("ConcourseEIP",
+			"ConcourseEIP")
+		eip := &gocf.EC2EIP{}
+		if isVPCDeployment() {
+			eip.Domain = gocf.String("vpc")
+			dns.associateAddressArgs = fmt.Sprintf(`--allow-reassociation --allocation-id { "Fn::GetAtt" : [ "%s" , "AllocationId" ] }`,
+				eipResourceName)
+		} else {
+			dns.associateAddressArgs = fmt.Sprintf(`--public-ip { "Ref" : "%s" }`,
+				eipResourceName)
+		}
+		template.AddResource(eipResourceName, eip)
+		recordSet.TTL = gocf.String("300")
+		recordSet.ResourceRecords = gocf.StringList(gocf.Ref(eipResourceName).String())
+		dns.externalURL = fmt.Sprintf("http://%s:%d", domainName, concourseWebPort)
+	}
+	template.AddResource(recordSetResourceName, recordSet)
+	return dns
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateDNSOptions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		hostedZoneID string
+		domainName   string
+		loadBalancer string
+		asgMaxSize   int
+		valid        bool
+	}{
+		{"disabled", "", "", loadBalancerNone, 2, true},
+		{"missing hosted zone", "", "ci.example.com", loadBalancerNone, 1, false},
+		{"missing domain name", "Z1", "", loadBalancerNone, 1, false},
+		{"Elastic IP", "Z1", "ci.example.com", loadBalancerNone, 1, true},
+		{"Elastic IP with multiple web nodes", "Z1", "ci.example.com", loadBalancerNone, 2, false},
+		{"load balancer with multiple web nodes", "Z1", "ci.example.com", loadBalancerApplication, 2, true},
+	}
+	savedOptions := options
+	defer func() {
+		options = savedOptions
+	}()
+	for _, eachCase := range testCases {
+		options = newTestProvisionOptions()
+		options.HostedZoneID = eachCase.hostedZoneID
+		options.DomainName = eachCase.domainName
+		options.LoadBalancer = eachCase.loadBalancer
+		options.ASGMaxSize = eachCase.asgMaxSize
+		validateErr := validateDNSOptions()
+		if eachCase.valid != (nil == validateErr) {
+			t.Fatalf("%s: expected valid=%t, got %v", eachCase.name, eachCase.valid, validateErr)
+		}
+	}
+}
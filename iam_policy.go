@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+)
+
+// Deploy permissions that can be granted to the instance role s.t.
+// pipelines can provision the service
+const (
+	deployPermissionCloudFormation = "cloudformation"
+	deployPermissionLambda         = "lambda"
+	deployPermissionPassRole       = "iam-passrole"
+	// The IAM, EC2, ASG, RDS, Secrets Manager and API Gateway resources
+	// that the SpartaCICD stack itself creates. Required by the pipeline.yml
+	// provision job.
+	deployPermissionStackResources = "stack-resources"
+)
+
+var allDeployPermissions = []string{
+	deployPermissionCloudFormation,
+	deployPermissionLambda,
+	deployPermissionPassRole,
+	deployPermissionStackResources,
+}
+
+// Deploy permissions granted by default. The stack resource permissions are
+// broad enough to escalate to the instance role's own privileges, so they're
+// opt-in.
+var defaultDeployPermissions = []string{
+	deployPermissionCloudFormation,
+	deployPermissionLambda,
+	deployPermissionPassRole,
+}
+
+// Services that the SpartaCICD stack creates resources with. Most of them
+// don't support resource level permissions for Create* actions.
+var stackResourceServices = []string{
+	"autoscaling",
+	"ec2",
+	"elasticloadbalancing",
+	"rds",
+	"route53",
+	"secretsmanager",
+	"ssm",
+	"apigateway",
+	"s3",
+}
+
+// Object keys used by the pipeline.yml Version and SourceArchive resources
+const (
+	semVerObjectKey      = "SpartaCICDSemVer"
+	sourceArchivePattern = "SpartaCICD-*.tgz"
+)
+
+// instanceRolePolicy describes the permissions granted to the Concourse EC2
+// instance role
+type instanceRolePolicy struct {
+	// Service (and CloudFormation stack) name
+	serviceName string
+	// Bucket and key of the Sparta artifact the instance downloads at boot
+	artifactBucket string
+	artifactKey    string
+	// Subset of allDeployPermissions
+	deployPermissions []string
+	// Grant Action:* Resource:* rather than scoped permissions
+	admin bool
+	// Secret ARN with the DB password
+	dbPasswordSecretARN *gocf.StringExpr
+	// Secret ARN with the control plane configuration
+	controlPlaneSecretARN *gocf.StringExpr
+	// Allow the instance to claim the Elastic IP at boot
+	associateAddress bool
+	// Optional secret ARN where the TSA keys are shared with the worker pool
+	tsaKeysSecretARN *gocf.StringExpr
+	// Optional SSM parameter prefix where the sync status is published
+	statusParameterPrefix string
+}
+
+// Return an ARN for a resource in the stack's region and account
+func regionalARN(service string, resource string) *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String(fmt.Sprintf("arn:aws:%s:", service)),
+		gocf.Ref("AWS::Region").String(),
+		gocf.String(":"),
+		gocf.Ref("AWS::AccountId").String(),
+		gocf.String(":"+resource))
+}
+
+// Return an ARN for an IAM resource in the stack's account
+func iamARN(resource string) *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String("arn:aws:iam::"),
+		gocf.Ref("AWS::AccountId").String(),
+		gocf.String(":"+resource))
+}
+
+// Verify the deploy permission names
+func validateDeployPermissions(permissions []string) error {
+	for _, eachPermission := range permissions {
+		known := false
+		for _, eachKnownPermission := range allDeployPermissions {
+			known = known || eachPermission == eachKnownPermission
+		}
+		if !known {
+			return fmt.Errorf("Unsupported deploy permission: %s (expected one of %v)",
+				eachPermission,
+				allDeployPermissions)
+		}
+	}
+	return nil
+}
+
+// Return the deploy permission statements scoped to the service's stack
+func (policy *instanceRolePolicy) deployStatements() ([]spartaIAM.PolicyStatement, error) {
+	validateErr := validateDeployPermissions(policy.deployPermissions)
+	if nil != validateErr {
+		return nil, validateErr
+	}
+	var statements []spartaIAM.PolicyStatement
+	for _, eachPermission := range policy.deployPermissions {
+		switch eachPermission {
+		case deployPermissionCloudFormation:
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   "Allow",
+				Action:   []string{"cloudformation:*"},
+				Resource: regionalARN("cloudformation", fmt.Sprintf("stack/%s/*", policy.serviceName)),
+			})
+			// ValidateTemplate doesn't support resource level permissions
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   "Allow",
+				Action:   []string{"cloudformation:ValidateTemplate"},
+				Resource: gocf.String("*"),
+			})
+			// Sparta uploads the service's code and template before
+			// provisioning the stack
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   "Allow",
+				Action:   []string{"s3:GetObject", "s3:PutObject"},
+				Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s/%s*", policy.artifactBucket, policy.serviceName)),
+			})
+		case deployPermissionLambda:
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   "Allow",
+				Action:   []string{"lambda:*"},
+				Resource: regionalARN("lambda", fmt.Sprintf("function:%s*", policy.serviceName)),
+			})
+		case deployPermissionPassRole:
+			// CloudFormation prefixes generated role names with the stack name
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   "Allow",
+				Action:   []string{"iam:PassRole"},
+				Resource: iamARN(fmt.Sprintf("role/%s*", policy.serviceName)),
+			})
+		case deployPermissionStackResources:
+			var actions []string
+			for _, eachService := range stackResourceServices {
+				actions = append(actions, eachService+":*")
+			}
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   "Allow",
+				Action:   actions,
+				Resource: gocf.String("*"),
+			})
+			// CloudFormation prefixes generated IAM names with the stack name
+			for _, eachResource := range []string{"role", "instance-profile"} {
+				statements = append(statements, spartaIAM.PolicyStatement{
+					Effect:   "Allow",
+					Action:   []string{"iam:*"},
+					Resource: iamARN(fmt.Sprintf("%s/%s*", eachResource, policy.serviceName)),
+				})
+			}
+		}
+	}
+	return statements, nil
+}
+
+// Return the instance role's policy statements
+func (policy *instanceRolePolicy) statements() ([]spartaIAM.PolicyStatement, error) {
+	var statements []spartaIAM.PolicyStatement
+	if policy.admin {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"*"},
+			Resource: gocf.String("*"),
+		})
+	}
+	// Download the Sparta binary at boot
+	statements = append(statements, spartaIAM.PolicyStatement{
+		Effect:   "Allow",
+		Action:   []string{"s3:GetObject"},
+		Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s/%s", policy.artifactBucket, policy.artifactKey)),
+	})
+	// The SourceArchive resource lists the bucket to find the latest version
+	statements = append(statements, spartaIAM.PolicyStatement{
+		Effect:   "Allow",
+		Action:   []string{"s3:ListBucket", "s3:GetBucketLocation"},
+		Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s", policy.artifactBucket)),
+	})
+	// Read and write the Version and SourceArchive objects
+	for _, eachPattern := range []string{semVerObjectKey, sourceArchivePattern} {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"s3:GetObject", "s3:PutObject"},
+			Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s/%s", policy.artifactBucket, eachPattern)),
+		})
+	}
+	// Download the Concourse binary from a private bucket
+	if concourseStatement := concourseReleaseStatement(); nil != concourseStatement {
+		statements = append(statements, *concourseStatement)
+	}
+	// Share the TSA keys with the worker pool
+	if nil != policy.tsaKeysSecretARN {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue", "secretsmanager:PutSecretValue"},
+			Resource: policy.tsaKeysSecretARN,
+		})
+	}
+	// Publish the sync status and read sync requests from the control plane
+	if "" != policy.statusParameterPrefix {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"ssm:GetParameter", "ssm:PutParameter"},
+			Resource: regionalARN("ssm", fmt.Sprintf("parameter%s/*", policy.statusParameterPrefix)),
+		})
+	}
+	// Read the DB password at boot
+	if nil != policy.dbPasswordSecretARN {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue"},
+			Resource: policy.dbPasswordSecretARN,
+		})
+	}
+	// Add the basic auth credentials to the control plane secret at boot
+	if nil != policy.controlPlaneSecretARN {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue", "secretsmanager:PutSecretValue"},
+			Resource: policy.controlPlaneSecretARN,
+		})
+	}
+	// AssociateAddress doesn't support resource level permissions
+	if policy.associateAddress {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"ec2:AssociateAddress"},
+			Resource: gocf.String("*"),
+		})
+	}
+	if policy.admin {
+		return statements, nil
+	}
+	deployStatements, deployStatementsErr := policy.deployStatements()
+	if nil != deployStatementsErr {
+		return nil, deployStatementsErr
+	}
+	return append(statements, deployStatements...), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+)
+
+func newTestRolePolicy() *instanceRolePolicy {
+	return &instanceRolePolicy{
+		serviceName:    "SpartaCICD",
+		artifactBucket: "artifacts",
+		artifactKey:    "SpartaCICD.zip",
+	}
+}
+
+// Return the JSON encoded resources of the statements that grant the action
+func statementResources(t *testing.T, statements []spartaIAM.PolicyStatement, action string) []string {
+	var resources []string
+	for _, eachStatement := range statements {
+		for _, eachAction := range eachStatement.Action {
+			if eachAction == action {
+				resourceJSON, resourceJSONErr := json.Marshal(eachStatement.Resource)
+				if nil != resourceJSONErr {
+					t.Fatal(resourceJSONErr)
+				}
+				resources = append(resources, string(resourceJSON))
+			}
+		}
+	}
+	return resources
+}
+
+// Returns true if any resource includes all the fragments
+func resourceMatches(resources []string, fragments []string) bool {
+	for _, eachResource := range resources {
+		matched := true
+		for _, eachFragment := range fragments {
+			if !strings.Contains(eachResource, eachFragment) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInstanceRolePolicyDefault(t *testing.T) {
+	statements, statementsErr := newTestRolePolicy().statements()
+	if nil != statementsErr {
+		t.Fatal(statementsErr)
+	}
+	for _, eachStatement := range statements {
+		for _, eachAction := range eachStatement.Action {
+			if eachAction == "*" || strings.HasSuffix(eachAction, ":*") {
+				t.Fatalf("Unexpected wildcard action: %#v", eachStatement)
+			}
+		}
+		resourceJSON, _ := json.Marshal(eachStatement.Resource)
+		if string(resourceJSON) == `"*"` {
+			t.Fatalf("Unexpected wildcard resource: %#v", eachStatement)
+		}
+	}
+	artifactResources := statementResources(t, statements, "s3:GetObject")
+	for _, eachResource := range []string{
+		`"arn:aws:s3:::artifacts/SpartaCICD.zip"`,
+		`"arn:aws:s3:::artifacts/SpartaCICDSemVer"`,
+		`"arn:aws:s3:::artifacts/SpartaCICD-*.tgz"`,
+	} {
+		if !resourceMatches(artifactResources, []string{eachResource}) {
+			t.Fatalf("Missing artifact resource %s: %v", eachResource, artifactResources)
+		}
+	}
+}
+
+func TestInstanceRolePolicyDefaultDeployPermissions(t *testing.T) {
+	policy := newTestRolePolicy()
+	policy.deployPermissions = defaultDeployPermissions
+	statements, statementsErr := policy.statements()
+	if nil != statementsErr {
+		t.Fatal(statementsErr)
+	}
+	// The stack resource permissions are opt-in
+	for _, eachService := range stackResourceServices {
+		if resources := statementResources(t, statements, eachService+":*"); len(resources) != 0 {
+			t.Fatalf("Unexpected %s:* statement: %v", eachService, resources)
+		}
+	}
+	if resources := statementResources(t, statements, "iam:*"); len(resources) != 0 {
+		t.Fatalf("Unexpected iam:* statement: %v", resources)
+	}
+}
+
+func TestInstanceRolePolicyAdmin(t *testing.T) {
+	policy := newTestRolePolicy()
+	policy.admin = true
+	policy.deployPermissions = allDeployPermissions
+	statements, statementsErr := policy.statements()
+	if nil != statementsErr {
+		t.Fatal(statementsErr)
+	}
+	adminResources := statementResources(t, statements, "*")
+	if len(adminResources) != 1 || adminResources[0] != `"*"` {
+		t.Fatalf("Expected an Action:* Resource:* statement, got %v", adminResources)
+	}
+	// The scoped deploy statements are redundant
+	if deployResources := statementResources(t, statements, "cloudformation:*"); len(deployResources) != 0 {
+		t.Fatalf("Unexpected deploy statements: %v", deployResources)
+	}
+}
+
+func TestInstanceRolePolicyDeployPermissions(t *testing.T) {
+	testCases := []struct {
+		permission string
+		action     string
+		resource   []string
+	}{
+		{deployPermissionCloudFormation, "cloudformation:*", []string{"arn:aws:cloudformation:", "AWS::Region", "AWS::AccountId", ":stack/SpartaCICD/*"}},
+		{deployPermissionCloudFormation, "s3:PutObject", []string{"arn:aws:s3:::artifacts/SpartaCICD*"}},
+		{deployPermissionLambda, "lambda:*", []string{"arn:aws:lambda:", "AWS::Region", "AWS::AccountId", ":function:SpartaCICD*"}},
+		{deployPermissionPassRole, "iam:PassRole", []string{"arn:aws:iam::", "AWS::AccountId", ":role/SpartaCICD*"}},
+		{deployPermissionStackResources, "ec2:*", []string{`"*"`}},
+		{deployPermissionStackResources, "iam:*", []string{"arn:aws:iam::", "AWS::AccountId", ":role/SpartaCICD*"}},
+		{deployPermissionStackResources, "iam:*", []string{"arn:aws:iam::", "AWS::AccountId", ":instance-profile/SpartaCICD*"}},
+	}
+	for _, eachCase := range testCases {
+		policy := newTestRolePolicy()
+		policy.deployPermissions = []string{eachCase.permission}
+		statements, statementsErr := policy.statements()
+		if nil != statementsErr {
+			t.Fatal(statementsErr)
+		}
+		resources := statementResources(t, statements, eachCase.action)
+		if !resourceMatches(resources, eachCase.resource) {
+			t.Fatalf("%s: expected a %s resource in %v to include %v",
+				eachCase.permission,
+				eachCase.action,
+				resources,
+				eachCase.resource)
+		}
+		if len(statementResources(t, statements, "*")) != 0 {
+			t.Fatalf("%s: unexpected Action:* statement", eachCase.permission)
+		}
+	}
+}
+
+func TestInstanceRolePolicyInvalidPermission(t *testing.T) {
+	policy := newTestRolePolicy()
+	policy.deployPermissions = []string{"ec2"}
+	_, statementsErr := policy.statements()
+	if nil == statementsErr {
+		t.Fatal("Expected an unsupported deploy permission to fail")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"sort"
+	"time"
+)
+
+// Policies that select one of the images returned by the AMI lookup
+const (
+	// Most recently created image
+	imageSelectionNewest = "newest"
+	// Most recently created image that's at least SoakDays old
+	imageSelectionSoak = "soak"
+	// Image with the exact ImageName
+	imageSelectionName = "name"
+)
+
+var allImageSelectionPolicies = []string{
+	imageSelectionNewest,
+	imageSelectionSoak,
+	imageSelectionName,
+}
+
+// selectedImage is the metadata of the image chosen by the AMI lookup
+type selectedImage struct {
+	ID           string
+	Name         string
+	CreationDate time.Time
+}
+
+// newestImages sorts images by descending creation date, then name and ID
+type newestImages []*selectedImage
+
+func (images newestImages) Len() int {
+	return len(images)
+}
+
+func (images newestImages) Swap(i, j int) {
+	images[i], images[j] = images[j], images[i]
+}
+
+func (images newestImages) Less(i, j int) bool {
+	if !images[i].CreationDate.Equal(images[j].CreationDate) {
+		return images[i].CreationDate.After(images[j].CreationDate)
+	}
+	if images[i].Name != images[j].Name {
+		return images[i].Name > images[j].Name
+	}
+	return images[i].ID > images[j].ID
+}
+
+// imageSelector picks an image from the DescribeImages results. Only
+// available, non-deprecated images with a valid CreationDate are
+// considered. Images created at the same time are ordered by name s.t.
+// the result is deterministic.
+type imageSelector struct {
+	policy    string
+	soakDays  int
+	imageName string
+	// Time the soak period and deprecation times are compared against
+	now time.Time
+}
+
+// Return the imageSelector for the lookup's selection policy
+func newImageSelector(lookup *amiLookup, now time.Time) (*imageSelector, error) {
+	selector := &imageSelector{
+		policy:    lookup.SelectionPolicy,
+		soakDays:  lookup.SoakDays,
+		imageName: lookup.ImageName,
+		now:       now,
+	}
+	switch selector.policy {
+	case imageSelectionNewest:
+	case imageSelectionSoak:
+		if selector.soakDays < 0 {
+			return nil, fmt.Errorf("The AMI soak period must be >= 0 days: %d", selector.soakDays)
+		}
+	case imageSelectionName:
+		if "" == selector.imageName {
+			return nil, fmt.Errorf("An AMI name is required for the %s selection policy",
+				imageSelectionName)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported AMI selection policy: %s (expected one of %v)",
+			selector.policy,
+			allImageSelectionPolicies)
+	}
+	return selector, nil
+}
+
+// Return the image metadata if it can be selected, or the reason it's
+// skipped
+func (selector *imageSelector) candidate(image *ec2.Image) (*selectedImage, string) {
+	if nil == image || "" == aws.StringValue(image.ImageId) {
+		return nil, "missing image ID"
+	}
+	if aws.StringValue(image.State) != ec2.ImageStateAvailable {
+		return nil, fmt.Sprintf("state is %s", aws.StringValue(image.State))
+	}
+	if nil == image.CreationDate {
+		return nil, "missing creation date"
+	}
+	creationDate, creationDateErr := time.Parse(time.RFC3339, *image.CreationDate)
+	if nil != creationDateErr {
+		return nil, fmt.Sprintf("invalid creation date: %s", creationDateErr.Error())
+	}
+	if "" != aws.StringValue(image.DeprecationTime) {
+		deprecationTime, deprecationTimeErr := time.Parse(time.RFC3339, *image.DeprecationTime)
+		if nil != deprecationTimeErr {
+			return nil, fmt.Sprintf("invalid deprecation time: %s", deprecationTimeErr.Error())
+		}
+		if !selector.now.Before(deprecationTime) {
+			return nil, "deprecated"
+		}
+	}
+	switch selector.policy {
+	case imageSelectionSoak:
+		soakTime := selector.now.Add(-time.Duration(selector.soakDays) * 24 * time.Hour)
+		if creationDate.After(soakTime) {
+			return nil, fmt.Sprintf("created less than %d days ago", selector.soakDays)
+		}
+	case imageSelectionName:
+		if aws.StringValue(image.Name) != selector.imageName {
+			return nil, "name doesn't match"
+		}
+	}
+	return &selectedImage{
+		ID:           *image.ImageId,
+		Name:         aws.StringValue(image.Name),
+		CreationDate: creationDate,
+	}, ""
+}
+
+// Return the newest image that satisfies the selection policy
+func (selector *imageSelector) selectImage(images []*ec2.Image, logger *logrus.Logger) (*selectedImage, error) {
+	var candidates []*selectedImage
+	for _, eachImage := range images {
+		candidate, skipReason := selector.candidate(eachImage)
+		if nil == candidate {
+			logger.WithFields(logrus.Fields{
+				"Image":  eachImage,
+				"Reason": skipReason,
+			}).Debug("Skipping image")
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) <= 0 {
+		return nil, fmt.Errorf("None of the %d images satisfy the %s selection policy",
+			len(images),
+			selector.policy)
+	}
+	sort.Sort(newestImages(candidates))
+	return candidates[0], nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+var testSelectionTime = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestImageSelector(t *testing.T, policy string, soakDays int, imageName string) *imageSelector {
+	selector, selectorErr := newImageSelector(&amiLookup{
+		SelectionPolicy: policy,
+		SoakDays:        soakDays,
+		ImageName:       imageName,
+	}, testSelectionTime)
+	if nil != selectorErr {
+		t.Fatal(selectorErr)
+	}
+	return selector
+}
+
+func TestImageSelectorCandidate(t *testing.T) {
+	pendingImage := newTestImage("ami-pending", "xenial", "2017-05-01T00:00:00Z")
+	pendingImage.State = aws.String(ec2.ImageStatePending)
+	deprecatedImage := newTestImage("ami-deprecated", "xenial", "2017-05-01T00:00:00Z")
+	deprecatedImage.DeprecationTime = aws.String("2017-05-31T00:00:00Z")
+	deprecatingImage := newTestImage("ami-deprecating", "xenial", "2017-05-01T00:00:00Z")
+	deprecatingImage.DeprecationTime = aws.String("2017-06-02T00:00:00Z")
+	invalidDeprecationImage := newTestImage("ami-invalid-deprecation", "xenial", "2017-05-01T00:00:00Z")
+	invalidDeprecationImage.DeprecationTime = aws.String("soon")
+
+	testCases := []struct {
+		name      string
+		policy    string
+		soakDays  int
+		imageName string
+		image     *ec2.Image
+		selected  bool
+	}{
+		{"nil image", imageSelectionNewest, 0, "", nil, false},
+		{"missing image ID", imageSelectionNewest, 0, "", &ec2.Image{State: aws.String(ec2.ImageStateAvailable)}, false},
+		{"nil creation date", imageSelectionNewest, 0, "", newTestImage("ami-nodate", "xenial", ""), false},
+		{"invalid creation date", imageSelectionNewest, 0, "", newTestImage("ami-baddate", "xenial", "May 2017"), false},
+		{"not available", imageSelectionNewest, 0, "", pendingImage, false},
+		{"deprecated", imageSelectionNewest, 0, "", deprecatedImage, false},
+		{"deprecated in the future", imageSelectionNewest, 0, "", deprecatingImage, true},
+		{"invalid deprecation time", imageSelectionNewest, 0, "", invalidDeprecationImage, false},
+		{"available", imageSelectionNewest, 0, "", newTestImage("ami-available", "xenial", "2017-05-31T23:00:00Z"), true},
+		{"inside soak period", imageSelectionSoak, 7, "", newTestImage("ami-fresh", "xenial", "2017-05-28T00:00:00Z"), false},
+		{"after soak period", imageSelectionSoak, 7, "", newTestImage("ami-soaked", "xenial", "2017-05-25T00:00:00Z"), true},
+		{"zero soak days", imageSelectionSoak, 0, "", newTestImage("ami-fresh", "xenial", "2017-05-31T23:00:00Z"), true},
+		{"exact name", imageSelectionName, 0, "xenial-20170501", newTestImage("ami-named", "xenial-20170501", "2017-05-01T00:00:00Z"), true},
+		{"name prefix", imageSelectionName, 0, "xenial", newTestImage("ami-named", "xenial-20170501", "2017-05-01T00:00:00Z"), false},
+	}
+	for _, eachCase := range testCases {
+		selector := newTestImageSelector(t, eachCase.policy, eachCase.soakDays, eachCase.imageName)
+		candidate, skipReason := selector.candidate(eachCase.image)
+		if eachCase.selected != (nil != candidate) {
+			t.Fatalf("%s: expected selected=%t (reason: %s)", eachCase.name, eachCase.selected, skipReason)
+		}
+		if nil == candidate && "" == skipReason {
+			t.Fatalf("%s: missing skip reason", eachCase.name)
+		}
+	}
+}
+
+func TestImageSelectorSelectImage(t *testing.T) {
+	testCases := []struct {
+		name      string
+		policy    string
+		soakDays  int
+		imageName string
+		images    []*ec2.Image
+		imageID   string
+	}{
+		{"newest",
+			imageSelectionNewest, 0, "",
+			[]*ec2.Image{
+				newTestImage("ami-1", "xenial-1", "2017-01-01T00:00:00Z"),
+				newTestImage("ami-3", "xenial-3", "2017-03-01T00:00:00Z"),
+				newTestImage("ami-2", "xenial-2", "2017-02-01T00:00:00Z"),
+			},
+			"ami-3"},
+		{"newest skips invalid images",
+			imageSelectionNewest, 0, "",
+			[]*ec2.Image{
+				nil,
+				newTestImage("ami-1", "xenial-1", "2017-01-01T00:00:00Z"),
+				newTestImage("ami-nodate", "xenial-4", ""),
+			},
+			"ami-1"},
+		{"tie broken by name",
+			imageSelectionNewest, 0, "",
+			[]*ec2.Image{
+				newTestImage("ami-b", "xenial-a", "2017-03-01T00:00:00Z"),
+				newTestImage("ami-a", "xenial-b", "2017-03-01T00:00:00Z"),
+			},
+			"ami-a"},
+		{"tie broken by ID",
+			imageSelectionNewest, 0, "",
+			[]*ec2.Image{
+				newTestImage("ami-a", "xenial", "2017-03-01T00:00:00Z"),
+				newTestImage("ami-b", "xenial", "2017-03-01T00:00:00Z"),
+			},
+			"ami-b"},
+		{"soak",
+			imageSelectionSoak, 30, "",
+			[]*ec2.Image{
+				newTestImage("ami-1", "xenial-1", "2017-01-01T00:00:00Z"),
+				newTestImage("ami-4", "xenial-4", "2017-04-01T00:00:00Z"),
+				newTestImage("ami-5", "xenial-5", "2017-05-15T00:00:00Z"),
+			},
+			"ami-4"},
+		{"name",
+			imageSelectionName, 0, "xenial-1",
+			[]*ec2.Image{
+				newTestImage("ami-1", "xenial-1", "2017-01-01T00:00:00Z"),
+				newTestImage("ami-2", "xenial-2", "2017-02-01T00:00:00Z"),
+			},
+			"ami-1"},
+		{"no candidates",
+			imageSelectionSoak, 365, "",
+			[]*ec2.Image{
+				newTestImage("ami-1", "xenial-1", "2017-01-01T00:00:00Z"),
+			},
+			""},
+	}
+	for _, eachCase := range testCases {
+		selector := newTestImageSelector(t, eachCase.policy, eachCase.soakDays, eachCase.imageName)
+		image, imageErr := selector.selectImage(eachCase.images, logrus.New())
+		if "" == eachCase.imageID {
+			if nil == imageErr {
+				t.Fatalf("%s: expected an error, selected %s", eachCase.name, image.ID)
+			}
+			continue
+		}
+		if nil != imageErr {
+			t.Fatalf("%s: %s", eachCase.name, imageErr.Error())
+		}
+		if image.ID != eachCase.imageID {
+			t.Fatalf("%s: expected %s, selected %s", eachCase.name, eachCase.imageID, image.ID)
+		}
+	}
+}
+
+func TestNewImageSelectorValidation(t *testing.T) {
+	invalidLookups := []amiLookup{
+		{SelectionPolicy: "oldest"},
+		{SelectionPolicy: imageSelectionSoak, SoakDays: -1},
+		{SelectionPolicy: imageSelectionName},
+	}
+	for _, eachLookup := range invalidLookups {
+		lookup := eachLookup
+		if _, selectorErr := newImageSelector(&lookup, testSelectionTime); nil == selectorErr {
+			t.Fatalf("Expected lookup to be rejected: %#v", lookup)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	sparta "github.com/mweagle/Sparta"
+)
+
+// Types of load balancer that can front the Concourse web node
+const (
+	loadBalancerNone        = "none"
+	loadBalancerClassic     = "classic"
+	loadBalancerApplication = "application"
+)
+
+const (
+	httpsPort = 443
+)
+
+// loadBalancer describes the load balancer that terminates TLS for the
+// Concourse web node
+type loadBalancer struct {
+	resourceName string
+	// Hostname clients use to reach Concourse
+	dnsName *gocf.StringExpr
+	// Route53 hosted zone of dnsName, for alias records
+	canonicalHostedZoneID *gocf.StringExpr
+	// Ingress rules that allow only the load balancer to reach the
+	// Concourse web port
+	webIngress []gocf.EC2SecurityGroupRule
+	// Classic ELB names to register the ASG with
+	loadBalancerNames []gocf.Stringable
+	// ALB target groups to register the ASG with
+	targetGroupARNs []gocf.Stringable
+}
+
+// Verify the load balancer options
+func validateLoadBalancerOptions() error {
+	switch options.LoadBalancer {
+	case loadBalancerNone:
+		return nil
+	case loadBalancerClassic:
+		// EC2-Classic ELBs don't have a security group, so the listener
+		// accepts HTTPS from anywhere
+		if !isVPCDeployment() && webIngressRestricted() {
+			return fmt.Errorf("--allowed-web-cidrs can't be enforced by a %s load balancer in EC2-Classic. Provide --vpc-id and --subnet-ids or remove the --allowed-web-cidrs restriction",
+				options.LoadBalancer)
+		}
+	case loadBalancerApplication:
+		if !isVPCDeployment() {
+			return fmt.Errorf("An application load balancer requires --vpc-id and --subnet-ids")
+		}
+	default:
+		return fmt.Errorf("Unsupported load balancer: %s", options.LoadBalancer)
+	}
+	if "" == options.CertificateARN {
+		return fmt.Errorf("--certificate-arn is required for the %s load balancer",
+			options.LoadBalancer)
+	}
+	return nil
+}
+
+// Add the security group that accepts HTTPS from the allowed web CIDRs.
+// Only used for VPC deployments.
+func addLoadBalancerSecurityGroup(template *gocf.Template) string {
+	lbSecurityGroupName := sparta.CloudFormationResourceName("ConcourseLBSecurityGroup",
+		"ConcourseLBSecurityGroup")
+	rules := gocf.EC2SecurityGroupRuleList(cidrIngressRules(options.AllowedWebCIDRs, httpsPort))
+	template.AddResource(lbSecurityGroupName, &gocf.EC2SecurityGroup{
+		GroupDescription:     gocf.String("Concourse CI/CD load balancer"),
+		VpcId:                gocf.String(options.VPCID),
+		SecurityGroupIngress: &rules,
+	})
+	return lbSecurityGroupName
+}
+
+// Return the rule that allows the load balancer security group to reach
+// the Concourse web port
+func loadBalancerWebIngress(lbSecurityGroupName string) []gocf.EC2SecurityGroupRule {
+	return []gocf.EC2SecurityGroupRule{
+		gocf.EC2SecurityGroupRule{
+			SourceSecurityGroupId: gocf.GetAtt(lbSecurityGroupName, "GroupId"),
+			IpProtocol:            gocf.String("tcp"),
+			FromPort:              gocf.Integer(concourseWebPort),
+			ToPort:                gocf.Integer(concourseWebPort),
+		},
+	}
+}
+
+// Add a classic ELB with an HTTPS listener
+func addClassicLoadBalancer(template *gocf.Template) *loadBalancer {
+	elbResourceName := sparta.CloudFormationResourceName("ConcourseELB",
+		"ConcourseELB")
+	elb := &gocf.ElasticLoadBalancingLoadBalancer{
+		CrossZone: gocf.Bool(true),
+		Listeners: &gocf.ElasticLoadBalancingListenerList{
+			gocf.ElasticLoadBalancingListener{
+				LoadBalancerPort: gocf.String(fmt.Sprintf("%d", httpsPort)),
+				Protocol:         gocf.String("HTTPS"),
+				InstancePort:     gocf.String(fmt.Sprintf("%d", concourseWebPort)),
+				InstanceProtocol: gocf.String("HTTP"),
+				SSLCertificateId: gocf.String(options.CertificateARN),
+			},
+		},
+		HealthCheck: &gocf.ElasticLoadBalancingHealthCheck{
+			Target:             gocf.String(fmt.Sprintf("HTTP:%d/", concourseWebPort)),
+			HealthyThreshold:   gocf.String("3"),
+			UnhealthyThreshold: gocf.String("5"),
+			Interval:           gocf.String("30"),
+			Timeout:            gocf.String("5"),
+		},
+	}
+	lb := &loadBalancer{
+		resourceName:          elbResourceName,
+		dnsName:               gocf.GetAtt(elbResourceName, "DNSName"),
+		canonicalHostedZoneID: gocf.GetAtt(elbResourceName, "CanonicalHostedZoneNameID"),
+		loadBalancerNames:     []gocf.Stringable{gocf.Ref(elbResourceName).String()},
+	}
+	if isVPCDeployment() {
+		lbSecurityGroupName := addLoadBalancerSecurityGroup(template)
+		elb.Subnets = subnetIDList()
+		elb.SecurityGroups = gocf.StringList(gocf.GetAtt(lbSecurityGroupName, "GroupId"))
+		lb.webIngress = loadBalancerWebIngress(lbSecurityGroupName)
+	} else {
+		// EC2-Classic ELBs use the amazon-elb source security group
+		// Ref: http://docs.aws.amazon.com/elasticloadbalancing/latest/classic/elb-security-groups.html
+		elb.AvailabilityZones = gocf.GetAZs(gocf.String(""))
+		lb.webIngress = []gocf.EC2SecurityGroupRule{
+			gocf.EC2SecurityGroupRule{
+				SourceSecurityGroupName:    gocf.GetAtt(elbResourceName, "SourceSecurityGroup.GroupName"),
+				SourceSecurityGroupOwnerId: gocf.GetAtt(elbResourceName, "SourceSecurityGroup.OwnerAlias"),
+				IpProtocol:                 gocf.String("tcp"),
+				FromPort:                   gocf.Integer(concourseWebPort),
+				ToPort:                     gocf.Integer(concourseWebPort),
+			},
+		}
+	}
+	template.AddResource(elbResourceName, elb)
+	return lb
+}
+
+// Add an ALB with an HTTPS listener that forwards to the Concourse
+// target group
+func addApplicationLoadBalancer(template *gocf.Template) *loadBalancer {
+	albResourceName := sparta.CloudFormationResourceName("ConcourseALB",
+		"ConcourseALB")
+	targetGroupResourceName := sparta.CloudFormationResourceName("ConcourseALBTargetGroup",
+		"ConcourseALBTargetGroup")
+	listenerResourceName := sparta.CloudFormationResourceName("ConcourseALBListener",
+		"ConcourseALBListener")
+
+	lbSecurityGroupName := addLoadBalancerSecurityGroup(template)
+	template.AddResource(albResourceName, &gocf.ElasticLoadBalancingV2LoadBalancer{
+		Scheme:         gocf.String("internet-facing"),
+		Subnets:        subnetIDList(),
+		SecurityGroups: gocf.StringList(gocf.GetAtt(lbSecurityGroupName, "GroupId")),
+	})
+	template.AddResource(targetGroupResourceName, &gocf.ElasticLoadBalancingV2TargetGroup{
+		Port:            gocf.Integer(concourseWebPort),
+		Protocol:        gocf.String("HTTP"),
+		VpcId:           gocf.String(options.VPCID),
+		HealthCheckPath: gocf.String("/"),
+	})
+	template.AddResource(listenerResourceName, &gocf.ElasticLoadBalancingV2Listener{
+		LoadBalancerArn: gocf.Ref(albResourceName).String(),
+		Port:            gocf.Integer(httpsPort),
+		Protocol:        gocf.String("HTTPS"),
+		Certificates: &gocf.ElasticLoadBalancingV2ListenerCertificateList{
+			gocf.ElasticLoadBalancingV2ListenerCertificate{
+				CertificateArn: gocf.String(options.CertificateARN),
+			},
+		},
+		DefaultActions: &gocf.ElasticLoadBalancingV2ListenerActionList{
+			gocf.ElasticLoadBalancingV2ListenerAction{
+				Type:           gocf.String("forward"),
+				TargetGroupArn: gocf.Ref(targetGroupResourceName).String(),
+			},
+		},
+	})
+	return &loadBalancer{
+		resourceName:          albResourceName,
+		dnsName:               gocf.GetAtt(albResourceName, "DNSName"),
+		canonicalHostedZoneID: gocf.GetAtt(albResourceName, "CanonicalHostedZoneID"),
+		webIngress:            loadBalancerWebIngress(lbSecurityGroupName),
+		targetGroupARNs:       []gocf.Stringable{gocf.Ref(targetGroupResourceName).String()},
+	}
+}
+
+// Add the configured load balancer. Returns nil if Concourse isn't
+// fronted by a load balancer.
+func addLoadBalancerResources(template *gocf.Template) (*loadBalancer, error) {
+	switch options.LoadBalancer {
+	case "", loadBalancerNone:
+		return nil, nil
+	case loadBalancerClassic:
+		return addClassicLoadBalancer(template), nil
+	case loadBalancerApplication:
+		return addApplicationLoadBalancer(template), nil
+	default:
+		return nil, fmt.Errorf("Unsupported load balancer: %s", options.LoadBalancer)
+	}
+}
+
+// Return the userdata expression for the HTTPS URL of the load balancer
+func (lb *loadBalancer) userDataExternalURL() string {
+	return fmt.Sprintf(`https://{ "Fn::GetAtt" : [ "%s" , "DNSName" ] }`, lb.resourceName)
+}
+
+// Register the ASG with the load balancer
+func (lb *loadBalancer) attach(asg *gocf.AutoScalingAutoScalingGroup) {
+	if len(lb.loadBalancerNames) > 0 {
+		asg.LoadBalancerNames = gocf.StringList(lb.loadBalancerNames...)
+	}
+	if len(lb.targetGroupARNs) > 0 {
+		asg.TargetGroupARNs = gocf.StringList(lb.targetGroupARNs...)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateLoadBalancerOptions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		loadBalancer string
+		vpcID        string
+		webCIDRs     []string
+		valid        bool
+	}{
+		{"none", loadBalancerNone, "", []string{"10.0.0.0/8"}, true},
+		{"classic in EC2-Classic", loadBalancerClassic, "", []string{anyIPv4CIDR}, true},
+		{"classic in EC2-Classic with restricted CIDRs", loadBalancerClassic, "", []string{"10.0.0.0/8"}, false},
+		{"classic in a VPC with restricted CIDRs", loadBalancerClassic, "vpc-1", []string{"10.0.0.0/8"}, true},
+		{"application in EC2-Classic", loadBalancerApplication, "", []string{anyIPv4CIDR}, false},
+		{"application in a VPC with restricted CIDRs", loadBalancerApplication, "vpc-1", []string{"10.0.0.0/8"}, true},
+		{"unsupported", "network", "vpc-1", []string{anyIPv4CIDR}, false},
+	}
+	savedOptions := options
+	defer func() {
+		options = savedOptions
+	}()
+	for _, eachCase := range testCases {
+		options = newTestProvisionOptions()
+		options.LoadBalancer = eachCase.loadBalancer
+		options.VPCID = eachCase.vpcID
+		options.AllowedWebCIDRs = eachCase.webCIDRs
+		validateErr := validateLoadBalancerOptions()
+		if eachCase.valid != (nil == validateErr) {
+			t.Fatalf("%s: expected valid=%t, got %v", eachCase.name, eachCase.valid, validateErr)
+		}
+	}
+}
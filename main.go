@@ -7,13 +7,11 @@ import (
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/asaskevich/govalidator"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	gocf "github.com/crewjam/go-cloudformation"
 	sparta "github.com/mweagle/Sparta"
 	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
-	spartaIAM "github.com/mweagle/Sparta/aws/iam"
 
 	"github.com/mweagle/SpartaCICD/concourse"
 	"github.com/mweagle/SpartaCICD/resources"
@@ -21,128 +19,129 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 )
 
 const (
 	databaseMasterUsername = "concourse"
-	// The parameter MasterUserPassword is not a valid password because it is shorter than 8 characters.
-	databaseMasterPassword = "picard1337"
 )
 
 // Additional command line options used for both the provision
 // and CLI commands
 type optionsStruct struct {
-	Username   string `valid:"required,match(\\w+)"`
-	Password   string `valid:"required,match(\\w+)"`
-	SSHKeyName string `valid:"-"`
+	Username              string    `valid:"required,match(\\w+)"`
+	Password              string    `valid:"required,match(\\w+)"`
+	SSHKeyName            string    `valid:"-"`
+	DBPasswordSource      string    `valid:"in(generated|secretsmanager)"`
+	DBPasswordSecretID    string    `valid:"-"`
+	VPCID                 string    `valid:"-"`
+	SubnetIDs             []string  `valid:"-"`
+	AllowedWebCIDRs       []string  `valid:"-"`
+	AllowedSSHCIDRs       []string  `valid:"-"`
+	InstanceRoleAdmin     bool      `valid:"-"`
+	DeployPermissions     []string  `valid:"-"`
+	LoadBalancer          string    `valid:"-"`
+	CertificateARN        string    `valid:"-"`
+	HostedZoneID          string    `valid:"-"`
+	DomainName            string    `valid:"-"`
+	InstanceType          string    `valid:"-"`
+	DBInstanceClass       string    `valid:"-"`
+	DBAllocatedStorage    int       `valid:"-"`
+	ASGMinSize            int       `valid:"-"`
+	ASGMaxSize            int       `valid:"-"`
+	WorkerPool            bool      `valid:"-"`
+	WorkerInstanceType    string    `valid:"-"`
+	WorkerMinSize         int       `valid:"-"`
+	WorkerMaxSize         int       `valid:"-"`
+	ConcourseVersion      string    `valid:"-"`
+	ConcourseSHA256       string    `valid:"-"`
+	ConcourseS3URL        string    `valid:"-"`
+	AMILookup             amiLookup `valid:"-"`
+	DBEncrypted           bool      `valid:"-"`
+	DBKMSKeyID            string    `valid:"-"`
+	DBMultiAZ             bool      `valid:"-"`
+	DBBackupRetentionDays int       `valid:"-"`
+	DBBackupWindow        string    `valid:"-"`
+	DBMaintenanceWindow   string    `valid:"-"`
+	DBEngineVersion       string    `valid:"-"`
+	DBDeletionPolicy      string    `valid:"-"`
+	DBRestoreSnapshotID   string    `valid:"-"`
+	ExportOutputs         bool      `valid:"-"`
 }
 
 var options optionsStruct
 
-// Nothing super interesting to do here.  In a real system you might
-// actually define the lambda functions in the same codebase.
+// Sync command options. Empty values are resolved from the optional
+// JSON config file and then the concourse package defaults.
+var syncConfigFile string
+var syncOptions concourse.SyncOptions
+
+// Control plane API. GET reports the Concourse URL, the last sync result
+// and the pipeline states. Authenticated POSTs trigger a sync or a job build.
 func ciCDConfigurator(event *json.RawMessage,
 	context *sparta.LambdaContext,
 	w http.ResponseWriter,
 	logger *logrus.Logger) {
 
-	configuration, _ := sparta.Discover()
-
+	var lambdaEvent sparta.APIGatewayLambdaJSONEvent
+	decodeErr := json.Unmarshal([]byte(*event), &lambdaEvent)
+	if nil != decodeErr {
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
 	logger.WithFields(logrus.Fields{
-		"Discovery": configuration,
-	}).Info("Custom resource request")
-
-	fmt.Fprint(w, "Hello World")
-}
+		"Method":    lambdaEvent.Method,
+		"RequestID": context.AWSRequestID,
+	}).Info("Control plane request")
 
-// Given a slice of EC2 images, return the most recently Created one.
-func mostRecentImageID(images []*ec2.Image) (string, error) {
-	if len(images) <= 0 {
-		return "", fmt.Errorf("No images to search")
+	stackName, stackNameErr := discoverStackName()
+	if nil != stackNameErr {
+		logger.WithFields(logrus.Fields{
+			"Error": stackNameErr,
+		}).Error("Failed to discover the control plane stack")
+		http.Error(w, "Control plane unavailable", http.StatusInternalServerError)
+		return
 	}
-	var mostRecentImage *ec2.Image
-	for _, eachImage := range images {
-		if nil == mostRecentImage {
-			mostRecentImage = eachImage
-		} else {
-			curTime, curTimeErr := time.Parse(time.RFC3339, *mostRecentImage.CreationDate)
-			if nil != curTimeErr {
-				return "", curTimeErr
-			}
-			testTime, testTimeErr := time.Parse(time.RFC3339, *eachImage.CreationDate)
-			if nil != testTimeErr {
-				return "", testTimeErr
-			}
-			if (testTime.Unix() - curTime.Unix()) > 0 {
-				mostRecentImage = eachImage
-			}
-		}
+	controlPlane, controlPlaneErr := newControlPlane(stackName)
+	if nil != controlPlaneErr {
+		logger.WithFields(logrus.Fields{
+			"Error": controlPlaneErr,
+		}).Error("Failed to load control plane configuration")
+		http.Error(w, "Control plane unavailable", http.StatusInternalServerError)
+		return
 	}
-	return *mostRecentImage.ImageId, nil
+	statusCode, response := controlPlane.Handle(&concourse.ControlPlaneRequest{
+		Method:  lambdaEvent.Method,
+		Headers: lambdaEvent.Headers,
+		Body:    []byte(lambdaEvent.Body),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
 }
 
 // Lambda CustomResource function that looks up the latest Ubuntu AMI ID for the
 // current region and returns a map with the latest AMI IDs via the resource's
-// outputs.  For this example we're going to look for the latest Ubuntu 16.04
-// release.
+// outputs.  The name pattern, owners, architecture, virtualization and root
+// device type are read from the resource properties and default to the latest
+// Ubuntu 16.04 release.
 // Ref: https://help.ubuntu.com/community/EC2StartersGuide#Official_Ubuntu_Cloud_Guest_Amazon_Machine_Images_.28AMIs.29
 func ubuntuAMICustomResource(requestType string,
 	stackID string,
 	properties map[string]interface{},
 	logger *logrus.Logger) (map[string]interface{}, error) {
-	if requestType != "Create" {
-		return map[string]interface{}{}, nil
-	}
-
-	// Setup the common filters
-	describeImageFilters := []*ec2.Filter{}
-	describeImageFilters = append(describeImageFilters, &ec2.Filter{
-		Name:   aws.String("name"),
-		Values: []*string{aws.String("*hvm-ssd/ubuntu-xenial-16.04-amd64-server*")},
-	})
-	describeImageFilters = append(describeImageFilters, &ec2.Filter{
-		Name:   aws.String("root-device-type"),
-		Values: []*string{aws.String("ebs")},
-	})
-	describeImageFilters = append(describeImageFilters, &ec2.Filter{
-		Name:   aws.String("architecture"),
-		Values: []*string{aws.String("x86_64")},
-	})
-	describeImageFilters = append(describeImageFilters, &ec2.Filter{
-		Name:   aws.String("virtualization-type"),
-		Values: []*string{aws.String("hvm")},
-	})
-
-	// Get the HVM AMIs
-	params := &ec2.DescribeImagesInput{
-		Filters: describeImageFilters,
-		Owners:  []*string{aws.String("099720109477")},
-	}
 	logger.Level = logrus.DebugLevel
 	ec2Svc := ec2.New(spartaAWS.NewSession(logger))
-	describeImagesOutput, describeImagesOutputErr := ec2Svc.DescribeImages(params)
-	if nil != describeImagesOutputErr {
-		return nil, describeImagesOutputErr
-	}
-	logger.WithFields(logrus.Fields{
-		"DescribeImagesOutput":    describeImagesOutput,
-		"DescribeImagesOutputErr": describeImagesOutputErr,
-	}).Info("Results")
-
-	amiID, amiIDErr := mostRecentImageID(describeImagesOutput.Images)
-	if nil != amiIDErr {
-		return nil, amiIDErr
-	}
+	return amiCustomResourceOutputs(requestType, properties, ec2Svc, logger)
+}
 
-	// Set the HVM type
-	outputProps := map[string]interface{}{
-		"HVM": amiID,
+// Expand the userdata template at resourcePath into a CloudFormation
+// expression
+func expandUserData(resourcePath string, userDataProps map[string]interface{}) (*gocf.StringExpr, error) {
+	userDataTemplateInput, userDataTemplateInputErr := resources.FSString(false, resourcePath)
+	if nil != userDataTemplateInputErr {
+		return nil, userDataTemplateInputErr
 	}
-	logger.WithFields(logrus.Fields{
-		"Outputs": outputProps,
-	}).Info("CustomResource outputs")
-	return outputProps, nil
+	return spartaCF.ConvertToTemplateExpression(strings.NewReader(userDataTemplateInput), userDataProps)
 }
 
 // The CloudFormation template decorator that inserts all the other
@@ -160,8 +159,6 @@ func ciCDLambdaDecorator(customResourceAMILookupName string,
 		logger *logrus.Logger) error {
 		// Create the launch configuration with Metadata to download the ZIP file, unzip it & launch the
 		// golang binary...
-		dbSecurityGroupName := sparta.CloudFormationResourceName("ConcoursePostgresqlSG",
-			"ConcoursePostgresqlSG")
 		dbInstanceName := sparta.CloudFormationResourceName("ConcoursePostgresql",
 			"ConcoursePostgresql")
 		asgLaunchConfigurationName := sparta.CloudFormationResourceName("ConcourseCIASGLaunchConfig",
@@ -174,80 +171,70 @@ func ciCDLambdaDecorator(customResourceAMILookupName string,
 			"ConcourseCIEC2InstanceProfile")
 
 		//////////////////////////////////////////////////////////////////////////////
-		// 1 - Create the security group for the Concourse EC2 instance
+		// 1 - Create the optional load balancer and the security group for the
+		// Concourse EC2 instance
+		lb, lbErr := addLoadBalancerResources(template)
+		if nil != lbErr {
+			return lbErr
+		}
+		dns := addDNSResources(template, lb)
 		ec2SecurityGroup := &gocf.EC2SecurityGroup{
-			GroupDescription: gocf.String("Concourse CI/CD Group"),
-			SecurityGroupIngress: &gocf.EC2SecurityGroupRuleList{
-				gocf.EC2SecurityGroupRule{
-					CidrIp:     gocf.String("0.0.0.0/0"),
-					IpProtocol: gocf.String("tcp"),
-					FromPort:   gocf.Integer(8080),
-					ToPort:     gocf.Integer(8080),
-				},
-				gocf.EC2SecurityGroupRule{
-					CidrIp:     gocf.String("0.0.0.0/0"),
-					IpProtocol: gocf.String("tcp"),
-					FromPort:   gocf.Integer(22),
-					ToPort:     gocf.Integer(22),
-				},
-			},
+			GroupDescription:     gocf.String("Concourse CI/CD Group"),
+			SecurityGroupIngress: concourseIngressRules(lb),
 		}
-		// TODO - when deploying to a VPC, remove this when
-		// https://forums.aws.amazon.com/thread.jspa?messageID=713978
-		// is fixed
-		/*ec2SecurityGroupResource := */ template.AddResource(ec2SecurityGroupResourceName, ec2SecurityGroup)
-		//ec2SecurityGroupResource.DeletionPolicy = "Retain"
+		if isVPCDeployment() {
+			ec2SecurityGroup.VpcId = gocf.String(options.VPCID)
+		}
+		template.AddResource(ec2SecurityGroupResourceName, ec2SecurityGroup)
 
 		//////////////////////////////////////////////////////////////////////////////
 		// 2 - Create the DB Instance, enable access from the EC2 instance...
-		dbSecurityGroup := &gocf.RDSDBSecurityGroup{
-			GroupDescription: gocf.String("Allow access from Concourse CI server"),
-			DBSecurityGroupIngress: &gocf.RDSSecurityGroupRuleList{
-				gocf.RDSSecurityGroupRule{
-					EC2SecurityGroupName:    gocf.Ref(ec2SecurityGroupResourceName).String(),
-					EC2SecurityGroupOwnerId: gocf.Ref("AWS::AccountId").String(),
-				},
-			},
+		dbPassword, dbPasswordErr := addDBPasswordResources(template)
+		if nil != dbPasswordErr {
+			return dbPasswordErr
 		}
-		template.AddResource(dbSecurityGroupName, dbSecurityGroup)
-
-		// Create the DB instance
 		dbInstance := &gocf.RDSDBInstance{
 			DBName:             gocf.String("atc"),
 			Engine:             gocf.String("postgres"),
-			AllocatedStorage:   gocf.String("10"),
-			DBInstanceClass:    gocf.String("db.t2.micro"),
+			AllocatedStorage:   gocf.String(fmt.Sprintf("%d", options.DBAllocatedStorage)),
+			DBInstanceClass:    gocf.String(options.DBInstanceClass),
 			MasterUsername:     gocf.String(databaseMasterUsername),
-			MasterUserPassword: gocf.String(databaseMasterPassword),
-			DBSecurityGroups: gocf.StringList(
-				gocf.Ref(dbSecurityGroupName),
-			),
+			MasterUserPassword: dbPassword.masterUserPassword,
 		}
+		configureDBInstance(dbInstance)
+		addDBNetworkResources(template, dbInstance, ec2SecurityGroupResourceName)
 		dbCFResource := template.AddResource(dbInstanceName, dbInstance)
+		dbCFResource.DeletionPolicy = options.DBDeletionPolicy
 		dbCFResource.DependsOn = append(dbCFResource.DependsOn, ec2SecurityGroupResourceName)
 
 		//////////////////////////////////////////////////////////////////////////////
 		// 3 - Create the ASG and associate the userdata with the EC2 init
-		// EC2 Instance Role...
-		statements := sparta.CommonIAMStatements.Core
-		statements = append(statements, spartaIAM.PolicyStatement{
-			Effect:   "Allow",
-			Action:   []string{"*"},
-			Resource: gocf.String("*"),
-		})
+		// Control plane configuration read by the API Gateway lambda. The
+		// web node adds the basic auth credentials at boot.
+		controlPlaneSecret := addControlPlaneResources(template)
 
-		statements = append(statements, spartaIAM.PolicyStatement{
-			Effect:   "Allow",
-			Action:   []string{"s3:GetObject"},
-			Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s/%s", S3Bucket, S3Key)),
-		})
-		// Enable all access to the S3 bucket s.t. the Version SemVer resource
-		// can manipulate objects.  This could be more tightly scoped.
-		statements = append(statements, spartaIAM.PolicyStatement{
-			Effect:   "Allow",
-			Action:   []string{"s3:*"},
-			Resource: gocf.String(fmt.Sprintf("arn:aws:s3:::%s", S3Bucket)),
-		})
+		// EC2 Instance Role...
+		rolePolicy := &instanceRolePolicy{
+			serviceName:           serviceName,
+			artifactBucket:        S3Bucket,
+			artifactKey:           S3Key,
+			deployPermissions:     options.DeployPermissions,
+			admin:                 options.InstanceRoleAdmin,
+			dbPasswordSecretARN:   dbPassword.secretARN,
+			controlPlaneSecretARN: controlPlaneSecret.secretARN,
+			associateAddress:      nil != dns && "" != dns.associateAddressArgs,
+			statusParameterPrefix: statusParameterPrefix(serviceName),
+		}
+		var tsaKeys *tsaKeysSecret
+		if options.WorkerPool {
+			tsaKeys = addTSAKeysResources(template)
+			rolePolicy.tsaKeysSecretARN = tsaKeys.secretARN
+		}
+		roleStatements, roleStatementsErr := rolePolicy.statements()
+		if nil != roleStatementsErr {
+			return roleStatementsErr
+		}
+		statements := append(sparta.CommonIAMStatements.Core, roleStatements...)
 
 		iamPolicyList := gocf.IAMPoliciesList{}
 		iamPolicyList = append(iamPolicyList,
@@ -279,17 +266,36 @@ func ciCDLambdaDecorator(customResourceAMILookupName string,
 			"ServiceName":            serviceName,
 			"DBInstanceResourceName": dbInstanceName,
 			"DBInstanceUser":         databaseMasterUsername,
-			"DBInstancePassword":     databaseMasterPassword,
+			"DBPasswordSecretID":     dbPassword.userDataSecretID,
 			"DBInstanceDatabaseName": "atc",
 			"Username":               options.Username,
 			"Password":               options.Password,
+			"ExternalURL":            fmt.Sprintf("http://$PUBLIC_HOSTNAME:%d", concourseWebPort),
+			"AssociateAddressArgs":   "",
+			"TSAKeysSecretID":        "",
+			"StatusParameterPrefix":  statusParameterPrefix(serviceName),
+			"ControlPlaneSecretID":   controlPlaneSecret.userDataSecretID,
 		}
-
-		userDataTemplateInput, userDataTemplateInputErr := resources.FSString(false, "/resources/source/userdata.sh")
-		if nil != userDataTemplateInputErr {
-			return userDataTemplateInputErr
+		for eachKey, eachValue := range concourseReleaseUserDataProps() {
+			userDataProps[eachKey] = eachValue
 		}
-		userDataExpression, userDataExpressionErr := spartaCF.ConvertToTemplateExpression(strings.NewReader(userDataTemplateInput), userDataProps)
+		if "" == options.ConcourseSHA256 {
+			logger.WithFields(logrus.Fields{
+				"Version": options.ConcourseVersion,
+			}).Warn("No --concourse-sha256 provided - the Concourse binary won't be verified")
+		}
+		if options.WorkerPool {
+			userDataProps["TSAKeysSecretID"] = tsaKeys.userDataSecretID
+		}
+		if nil != lb {
+			userDataProps["ExternalURL"] = lb.userDataExternalURL()
+		}
+		if nil != dns {
+			userDataProps["ExternalURL"] = dns.externalURL
+			userDataProps["AssociateAddressArgs"] = dns.associateAddressArgs
+		}
+
+		userDataExpression, userDataExpressionErr := expandUserData("/resources/source/userdata.sh", userDataProps)
 		if nil != userDataExpressionErr {
 			return userDataExpressionErr
 		}
@@ -301,7 +307,7 @@ func ciCDLambdaDecorator(customResourceAMILookupName string,
 
 		asgLaunchConfigurationResource := &gocf.AutoScalingLaunchConfiguration{
 			ImageId:            gocf.GetAtt(customResourceAMILookupName, "HVM"),
-			InstanceType:       gocf.String("t2.micro"),
+			InstanceType:       gocf.String(options.InstanceType),
 			KeyName:            gocf.String(options.SSHKeyName),
 			IamInstanceProfile: gocf.Ref(ec2InstanceProfileName).String(),
 			UserData:           gocf.Base64(userDataExpression),
@@ -314,15 +320,47 @@ func ciCDLambdaDecorator(customResourceAMILookupName string,
 
 		// Create the ASG
 		asgResource := &gocf.AutoScalingAutoScalingGroup{
-			// Empty Region is equivalent to all region AZs
-			// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/intrinsic-function-reference-getavailabilityzones.html
-			AvailabilityZones:       gocf.GetAZs(gocf.String("")),
 			LaunchConfigurationName: gocf.Ref(asgLaunchConfigurationName).String(),
-			MaxSize:                 gocf.String("1"),
-			MinSize:                 gocf.String("1"),
+			MaxSize:                 gocf.String(fmt.Sprintf("%d", options.ASGMaxSize)),
+			MinSize:                 gocf.String(fmt.Sprintf("%d", options.ASGMinSize)),
+		}
+		setASGPlacement(asgResource)
+		if nil != lb {
+			lb.attach(asgResource)
 		}
 		template.AddResource(asgResourceName, asgResource)
-		return nil
+
+		//////////////////////////////////////////////////////////////////////////////
+		// 4 - Stack outputs
+		if concourseURL := concourseURLOutput(lb, dns); nil != concourseURL {
+			addOutput(template, "ConcourseURL", "Concourse external URL", concourseURL)
+		}
+		addOutput(template, "DBEndpointAddress", "Concourse RDS endpoint address",
+			gocf.GetAtt(dbInstanceName, "Endpoint.Address"))
+		addOutput(template, "DBEndpointPort", "Concourse RDS endpoint port",
+			gocf.GetAtt(dbInstanceName, "Endpoint.Port"))
+		addOutput(template, "ASGName", "Concourse web node ASG name",
+			gocf.Ref(asgResourceName).String())
+		addOutput(template, "InstanceRoleARN", "Concourse web node instance role ARN",
+			gocf.GetAtt(ec2InstanceRoleName, "Arn"))
+		addOutput(template, "SecurityGroupID", "Concourse web node security group ID",
+			gocf.GetAtt(ec2SecurityGroupResourceName, "GroupId"))
+		addOutput(template, "ArtifactBucket", "S3 bucket with the Sparta and pipeline artifacts",
+			gocf.String(S3Bucket))
+
+		//////////////////////////////////////////////////////////////////////////////
+		// 5 - Optional worker ASG that registers with the web node's TSA
+		if !options.WorkerPool {
+			return nil
+		}
+		pool := &workerPool{
+			serviceName:                  serviceName,
+			tsaKeys:                      tsaKeys,
+			amiLookupName:                customResourceAMILookupName,
+			ec2SecurityGroupResourceName: ec2SecurityGroupResourceName,
+			userDataProps:                userDataProps,
+		}
+		return pool.addResources(template)
 	}
 }
 
@@ -340,6 +378,326 @@ func registerSpartaCICDFlags(command *cobra.Command) {
 
 }
 
+func registerProvisionFlags(command *cobra.Command) {
+	command.Flags().StringVar(&options.DBPasswordSource,
+		"db-password-source",
+		dbPasswordSourceGenerated,
+		"RDS master password source: generated or secretsmanager")
+	command.Flags().StringVar(&options.DBPasswordSecretID,
+		"db-password-secret",
+		"",
+		"Secrets Manager secret with a JSON password key for the secretsmanager source")
+	command.Flags().StringVar(&options.VPCID,
+		"vpc-id",
+		"",
+		"Optional VPC ID to provision into. Requires --subnet-ids")
+	command.Flags().StringSliceVar(&options.SubnetIDs,
+		"subnet-ids",
+		[]string{},
+		"Comma separated subnet IDs for the ASG and DB subnet group")
+	command.Flags().StringSliceVar(&options.AllowedWebCIDRs,
+		"allowed-web-cidrs",
+		[]string{anyIPv4CIDR},
+		"Comma separated CIDRs allowed to access the Concourse web UI")
+	command.Flags().StringSliceVar(&options.AllowedSSHCIDRs,
+		"allowed-ssh-cidrs",
+		[]string{anyIPv4CIDR},
+		fmt.Sprintf("Comma separated CIDRs allowed SSH access, or %s to disable SSH", noSSHIngress))
+	command.Flags().BoolVar(&options.InstanceRoleAdmin,
+		"instance-role-admin",
+		false,
+		"Grant the Concourse instance role full administrator access")
+	command.Flags().StringSliceVar(&options.DeployPermissions,
+		"instance-role-deploy-permissions",
+		defaultDeployPermissions,
+		fmt.Sprintf("Comma separated deploy permissions scoped to the service stack: %s. The pipeline.yml provision job requires %s",
+			strings.Join(allDeployPermissions, ", "),
+			deployPermissionStackResources))
+	command.Flags().StringVar(&options.LoadBalancer,
+		"load-balancer",
+		loadBalancerNone,
+		fmt.Sprintf("Load balancer that terminates HTTPS for Concourse: %s, %s or %s",
+			loadBalancerNone,
+			loadBalancerClassic,
+			loadBalancerApplication))
+	command.Flags().StringVar(&options.CertificateARN,
+		"certificate-arn",
+		"",
+		"ACM certificate ARN for the load balancer's HTTPS listener")
+	command.Flags().StringVar(&options.HostedZoneID,
+		"hosted-zone-id",
+		"",
+		"Optional Route53 hosted zone ID for the Concourse DNS record. Requires --domain-name")
+	command.Flags().StringVar(&options.DomainName,
+		"domain-name",
+		"",
+		"Optional Concourse domain name, aliased to the load balancer or an Elastic IP")
+	command.Flags().StringVar(&options.InstanceType,
+		"instance-type",
+		defaultInstanceType,
+		"Concourse web node EC2 instance type")
+	command.Flags().StringVar(&options.DBInstanceClass,
+		"db-instance-class",
+		defaultDBInstanceClass,
+		"RDS instance class")
+	command.Flags().IntVar(&options.DBAllocatedStorage,
+		"db-allocated-storage",
+		defaultDBAllocatedStorage,
+		"RDS allocated storage in GB")
+	command.Flags().IntVar(&options.ASGMinSize,
+		"asg-min-size",
+		1,
+		"Concourse web node ASG MinSize")
+	command.Flags().IntVar(&options.ASGMaxSize,
+		"asg-max-size",
+		1,
+		"Concourse web node ASG MaxSize. Values > 1 require a --load-balancer and no --worker-pool")
+	command.Flags().BoolVar(&options.WorkerPool,
+		"worker-pool",
+		false,
+		"Run the Concourse workers in a separate ASG rather than on the web node")
+	command.Flags().StringVar(&options.WorkerInstanceType,
+		"worker-instance-type",
+		defaultInstanceType,
+		"Concourse worker EC2 instance type")
+	command.Flags().IntVar(&options.WorkerMinSize,
+		"worker-min-size",
+		1,
+		"Concourse worker ASG MinSize")
+	command.Flags().IntVar(&options.WorkerMaxSize,
+		"worker-max-size",
+		1,
+		"Concourse worker ASG MaxSize")
+	command.Flags().StringVar(&options.ConcourseVersion,
+		"concourse-version",
+		defaultConcourseVersion,
+		"Concourse release to install")
+	command.Flags().StringVar(&options.ConcourseSHA256,
+		"concourse-sha256",
+		"",
+		"SHA256 of the Concourse binary. Instances fail to boot on a mismatch")
+	command.Flags().StringVar(&options.ConcourseS3URL,
+		"concourse-s3-url",
+		"",
+		"Optional s3://bucket/key of the Concourse binary, for accounts without internet access")
+	command.Flags().StringVar(&options.AMILookup.NamePattern,
+		"ami-name-pattern",
+		defaultAMINamePattern,
+		"AMI name filter")
+	command.Flags().StringSliceVar(&options.AMILookup.Owners,
+		"ami-owners",
+		[]string{defaultAMIOwner},
+		"Comma separated AMI owner account IDs or aliases")
+	command.Flags().StringVar(&options.AMILookup.Architecture,
+		"ami-architecture",
+		defaultAMIArchitecture,
+		"AMI architecture filter, eg x86_64 or arm64")
+	command.Flags().StringVar(&options.AMILookup.VirtualizationType,
+		"ami-virtualization-type",
+		defaultAMIVirtualizationType,
+		"AMI virtualization type filter")
+	command.Flags().StringVar(&options.AMILookup.RootDeviceType,
+		"ami-root-device-type",
+		defaultAMIRootDeviceType,
+		"AMI root device type filter")
+	command.Flags().StringVar(&options.AMILookup.PinnedAMI,
+		"ami-id",
+		"",
+		"Optional AMI ID to use rather than the selected AMI")
+	command.Flags().StringVar(&options.AMILookup.SelectionPolicy,
+		"ami-selection-policy",
+		defaultAMISelectionPolicy,
+		"Policy that selects one of the matching AMIs: newest, soak or name")
+	command.Flags().IntVar(&options.AMILookup.SoakDays,
+		"ami-soak-days",
+		0,
+		"Minimum age in days of the AMI selected by the soak policy")
+	command.Flags().StringVar(&options.AMILookup.ImageName,
+		"ami-name",
+		"",
+		"Exact AMI name selected by the name policy")
+	command.Flags().BoolVar(&options.DBEncrypted,
+		"db-encrypted",
+		false,
+		"Encrypt the RDS storage with the default RDS KMS key")
+	command.Flags().StringVar(&options.DBKMSKeyID,
+		"db-kms-key-id",
+		"",
+		"Optional KMS key ID or ARN for RDS storage encryption. Implies --db-encrypted")
+	command.Flags().BoolVar(&options.DBMultiAZ,
+		"db-multi-az",
+		false,
+		"Provision a Multi-AZ RDS instance")
+	command.Flags().IntVar(&options.DBBackupRetentionDays,
+		"db-backup-retention",
+		defaultDBBackupRetentionDays,
+		"RDS automated backup retention in days. 0 disables automated backups")
+	command.Flags().StringVar(&options.DBBackupWindow,
+		"db-backup-window",
+		"",
+		"Optional RDS backup window in UTC (hh24:mi-hh24:mi)")
+	command.Flags().StringVar(&options.DBMaintenanceWindow,
+		"db-maintenance-window",
+		"",
+		"Optional RDS maintenance window in UTC (ddd:hh24:mi-ddd:hh24:mi)")
+	command.Flags().StringVar(&options.DBEngineVersion,
+		"db-engine-version",
+		"",
+		"Optional Postgres engine version to pin")
+	command.Flags().StringVar(&options.DBDeletionPolicy,
+		"db-deletion-policy",
+		dbDeletionPolicySnapshot,
+		fmt.Sprintf("DB instance DeletionPolicy: %s, %s or %s",
+			dbDeletionPolicySnapshot,
+			dbDeletionPolicyRetain,
+			dbDeletionPolicyDelete))
+	command.Flags().StringVar(&options.DBRestoreSnapshotID,
+		"restore-from-snapshot",
+		"",
+		"Optional DB snapshot identifier to restore the Concourse database from. Requires --db-password-source secretsmanager with the snapshot's password")
+	command.Flags().BoolVar(&options.ExportOutputs,
+		"export-outputs",
+		false,
+		"Export the stack outputs as <StackName>-<OutputName> for cross-stack references")
+}
+
+func registerSyncFlags(command *cobra.Command) {
+	command.Flags().StringVar(&syncConfigFile,
+		"config",
+		"",
+		"Optional JSON file with sync settings")
+	command.Flags().StringVar(&syncOptions.RepoURL,
+		"repo",
+		"",
+		"Git repository URL to clone (default: https://github.com/mweagle/SpartaCICD)")
+	command.Flags().StringVar(&syncOptions.Branch,
+		"branch",
+		"",
+		"Git branch to clone (default: master)")
+	command.Flags().StringVar(&syncOptions.PipelinePath,
+		"pipeline-path",
+		"",
+		"Repository relative path of the pipeline file (default: pipeline.yml)")
+	command.Flags().StringVar(&syncOptions.PipelineName,
+		"pipeline-name",
+		"",
+		"Concourse pipeline name (default: SpartaCICD)")
+	command.Flags().StringVar(&syncOptions.TeamName,
+		"team",
+		"",
+		"Concourse team name (default: main)")
+	command.Flags().StringVar(&syncOptions.ConcourseURL,
+		"concourse-url",
+		"",
+		"Concourse ATC URL (default: http://localhost:8080)")
+	command.Flags().StringVar(&syncOptions.PipelineGlob,
+		"pipeline-glob",
+		"",
+		"Repository relative glob of pipeline files to sync (eg: ci/pipelines/*.yml)")
+	command.Flags().BoolVar(&syncOptions.DestroyRemovedPipelines,
+		"destroy-removed",
+		false,
+		"Destroy synced pipelines whose file was removed from the repo")
+	command.Flags().StringVar(&syncOptions.StateFile,
+		"state-file",
+		"",
+		"File that records the synced pipelines for --destroy-removed (default: $TMPDIR/SpartaCICD-pipelines.json)")
+	command.Flags().StringVar(&syncOptions.WebhookAddress,
+		"webhook-address",
+		"",
+		"Optional listen address (eg: :9090) for push webhooks that trigger a sync")
+	command.Flags().StringVar(&syncOptions.WebhookSecret,
+		"webhook-secret",
+		"",
+		"Shared secret used to verify push webhooks")
+	command.Flags().DurationVar(&syncOptions.CredentialsRefreshMargin,
+		"credentials-margin",
+		0,
+		"Set pipelines again this long before the injected credentials expire (default: 15m)")
+	command.Flags().StringVar(&syncOptions.CredentialProvider,
+		"credentials-provider",
+		"",
+		"Source of the injected credentials: ec2, env, shared or assume-role (default: ec2)")
+	command.Flags().StringVar(&syncOptions.SharedCredentialsFile,
+		"shared-credentials-file",
+		"",
+		"Shared credentials file for the shared provider (default: ~/.aws/credentials)")
+	command.Flags().StringVar(&syncOptions.SharedCredentialsProfile,
+		"profile",
+		"",
+		"Shared credentials profile for the shared provider (default: default)")
+	command.Flags().StringVar(&syncOptions.AssumeRoleARN,
+		"role-arn",
+		"",
+		"IAM role ARN to assume for the assume-role provider")
+	command.Flags().StringVar(&syncOptions.AssumeRoleExternalID,
+		"role-external-id",
+		"",
+		"Optional external ID for the assume-role provider")
+	command.Flags().StringVar(&syncOptions.AssumeRoleBaseProvider,
+		"role-base-provider",
+		"",
+		"Provider of the credentials used to assume the role: ec2, env or shared (default: ec2)")
+	command.Flags().StringVar(&syncOptions.AWSRegion,
+		"region",
+		"",
+		"AWS region for STS requests and the aws-region pipeline var (default: us-west-2)")
+	command.Flags().StringVar(&syncOptions.S3Bucket,
+		"s3-bucket",
+		"",
+		"S3 bucket for the s3-bucket pipeline var (the provisioned stack uses its artifact bucket)")
+	command.Flags().StringVar(&syncOptions.MetadataURL,
+		"metadata-url",
+		"",
+		"EC2 instance metadata service URL (default: http://169.254.169.254)")
+	command.Flags().BoolVar(&syncOptions.AllowIMDSv1,
+		"imds-v1-fallback",
+		false,
+		"Use IMDSv1 requests if an IMDSv2 token can't be obtained")
+	command.Flags().StringVar(&syncOptions.CredentialStore,
+		"credentials-store",
+		"",
+		"Where pipeline credentials are saved: inline, vault or ssm (default: inline). vault and ssm require an externally managed Concourse with that credential manager")
+	command.Flags().StringVar(&syncOptions.CredentialPathPrefix,
+		"credentials-prefix",
+		"",
+		"Vault path or SSM parameter prefix for pipeline credentials (default: /concourse)")
+	command.Flags().StringVar(&syncOptions.VaultAddress,
+		"vault-address",
+		"",
+		"Vault server address (default: $VAULT_ADDR)")
+	command.Flags().StringVar(&syncOptions.SSMKMSKeyID,
+		"ssm-kms-key",
+		"",
+		"Optional KMS key ID for SSM SecureString parameters")
+	command.Flags().StringVar(&syncOptions.ExternalURL,
+		"external-url",
+		"",
+		"Concourse URL reported to the control plane (default: the Concourse target URL)")
+	command.Flags().StringVar(&syncOptions.StatusParameterPrefix,
+		"status-parameter-prefix",
+		"",
+		"Optional SSM parameter prefix where the sync status is published for the control plane")
+}
+
+// JSON names of the boolean sync options, by flag name
+var syncBoolFlags = map[string]string{
+	"destroy-removed":  "destroyRemovedPipelines",
+	"imds-v1-fallback": "allowIMDSv1",
+}
+
+// Return the JSON names of the boolean sync options that were explicitly
+// set on the command line s.t. they override the config file
+func explicitSyncOptions(command *cobra.Command) map[string]bool {
+	explicitOptions := make(map[string]bool)
+	for eachFlag, eachOption := range syncBoolFlags {
+		if command.Flags().Changed(eachFlag) {
+			explicitOptions[eachOption] = true
+		}
+	}
+	return explicitOptions
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Main
 func main() {
@@ -351,15 +709,58 @@ func main() {
 		Short: "Periodically rebuild Concourse pipelines",
 		Long:  `Periodically scan the repo for pipelines and update them with ec2metadata credentials`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return concourse.SyncIt(options.Username, options.Password, sparta.OptionsGlobal.Logger)
+			resolvedOptions, resolvedOptionsErr := concourse.NewSyncOptions(syncConfigFile,
+				syncOptions,
+				explicitSyncOptions(cmd))
+			if nil != resolvedOptionsErr {
+				return resolvedOptionsErr
+			}
+			return concourse.SyncIt(options.Username,
+				options.Password,
+				resolvedOptions,
+				sparta.OptionsGlobal.Logger)
 		},
 	}
 	// Include the basic auth flags for the sync command
 	registerSpartaCICDFlags(syncCommand)
+	// And the repo, pipeline and Concourse target flags
+	registerSyncFlags(syncCommand)
 	sparta.CommandLineOptions.Root.AddCommand(syncCommand)
 
+	// Custom command to preview the pipeline changes a sync would apply.
+	// Exits with concourse.PipelineDiffExitCode if there are changes.
+	pipelineDiffCommand := &cobra.Command{
+		Use:   "pipeline-diff",
+		Short: "Show the changes a sync would apply to the Concourse pipelines",
+		Long:  `Render the repo's pipelines and diff their resources, jobs and groups against the configs in Concourse without setting them`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolvedOptions, resolvedOptionsErr := concourse.NewSyncOptions(syncConfigFile,
+				syncOptions,
+				explicitSyncOptions(cmd))
+			if nil != resolvedOptionsErr {
+				return resolvedOptionsErr
+			}
+			diffs, diffsErr := concourse.PlanPipelines(options.Username,
+				options.Password,
+				resolvedOptions,
+				sparta.OptionsGlobal.Logger)
+			if nil != diffsErr {
+				return diffsErr
+			}
+			concourse.WritePipelineDiffs(os.Stdout, diffs)
+			if exitCode := concourse.PipelineDiffsExitCode(diffs); 0 != exitCode {
+				os.Exit(exitCode)
+			}
+			return nil
+		},
+	}
+	registerSpartaCICDFlags(pipelineDiffCommand)
+	registerSyncFlags(pipelineDiffCommand)
+	sparta.CommandLineOptions.Root.AddCommand(pipelineDiffCommand)
+
 	// Add them to the standard provision command
 	registerSpartaCICDFlags(sparta.CommandLineOptions.Provision)
+	registerProvisionFlags(sparta.CommandLineOptions.Provision)
 
 	// And add the SSHKeyName option
 	sparta.CommandLineOptions.Provision.Flags().StringVarP(&options.SSHKeyName,
@@ -377,9 +778,48 @@ func main() {
 		fmt.Printf("Command: %s\n", command.Name())
 		switch command.Name() {
 		case "provision",
-			"sync":
+			"sync",
+			"pipeline-diff":
 			_, validationErr := govalidator.ValidateStruct(options)
-			return validationErr
+			if nil != validationErr {
+				return validationErr
+			}
+			if command.Name() != "provision" {
+				return nil
+			}
+			networkErr := validateNetworkOptions()
+			if nil != networkErr {
+				return networkErr
+			}
+			ingressErr := validateIngressOptions()
+			if nil != ingressErr {
+				return ingressErr
+			}
+			deployPermissionsErr := validateDeployPermissions(options.DeployPermissions)
+			if nil != deployPermissionsErr {
+				return deployPermissionsErr
+			}
+			lbErr := validateLoadBalancerOptions()
+			if nil != lbErr {
+				return lbErr
+			}
+			dnsErr := validateDNSOptions()
+			if nil != dnsErr {
+				return dnsErr
+			}
+			sizingErr := validateSizingOptions()
+			if nil != sizingErr {
+				return sizingErr
+			}
+			releaseErr := validateConcourseReleaseOptions()
+			if nil != releaseErr {
+				return releaseErr
+			}
+			amiErr := validateAMIOptions()
+			if nil != amiErr {
+				return amiErr
+			}
+			return validateDBOptions()
 		default:
 			return nil
 		}
@@ -393,10 +833,28 @@ func main() {
 		"ConcourseSecurityGroup")
 
 	// The primary lambda function
-	lambdaFn := sparta.NewLambda(sparta.IAMRoleDefinition{},
+	lambdaFn := sparta.NewLambda(sparta.IAMRoleDefinition{
+		Privileges: controlPlanePrivileges(),
+	},
 		ciCDConfigurator,
 		nil)
 
+	// Expose the control plane via API Gateway
+	stage := sparta.NewStage("v1")
+	apiGateway := sparta.NewAPIGateway("SpartaCICDControlPlane", stage)
+	apiResource, apiResourceErr := apiGateway.NewResource(controlPlaneResourcePath, lambdaFn)
+	if nil != apiResourceErr {
+		os.Exit(3)
+	}
+	_, getMethodErr := apiResource.NewMethod("GET", http.StatusOK)
+	if nil != getMethodErr {
+		os.Exit(3)
+	}
+	_, postMethodErr := apiResource.NewMethod("POST", http.StatusAccepted)
+	if nil != postMethodErr {
+		os.Exit(3)
+	}
+
 	// Lambda custom resource to lookup the latest Ubuntu AMIs
 	iamRoleCustomResource := sparta.IAMRoleDefinition{}
 	iamRoleCustomResource.Privileges = append(iamRoleCustomResource.Privileges,
@@ -412,7 +870,7 @@ func main() {
 	amiIDCustomResourceName, _ := lambdaFn.RequireCustomResource(iamRoleCustomResource,
 		ubuntuAMICustomResource,
 		&customResourceLambdaOptions,
-		nil)
+		options.AMILookup.properties())
 
 	// Get the resource name and pass it to the decorator
 	lambdaFn.Decorator = ciCDLambdaDecorator(amiIDCustomResourceName,
@@ -420,10 +878,10 @@ func main() {
 	var lambdaFunctions []*sparta.LambdaAWSInfo
 	lambdaFunctions = append(lambdaFunctions, lambdaFn)
 
-	err := sparta.Main("SpartaCICD",
+	err := sparta.Main(spartaCICDServiceName,
 		fmt.Sprintf("Provision a Concourse CICD system"),
 		lambdaFunctions,
-		nil,
+		apiGateway,
 		nil)
 	if err != nil {
 		os.Exit(1)
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	sparta "github.com/mweagle/Sparta"
+	"net"
+	"strings"
+)
+
+const (
+	postgresPort     = 5432
+	concourseWebPort = 8080
+	sshPort          = 22
+)
+
+const (
+	// Default CIDR for the web and SSH ingress rules
+	anyIPv4CIDR = "0.0.0.0/0"
+	// --allowed-ssh-cidrs value that removes the SSH ingress rule
+	noSSHIngress = "none"
+)
+
+// Returns true if the stack should be provisioned into a VPC rather than
+// EC2-Classic
+func isVPCDeployment() bool {
+	return "" != options.VPCID
+}
+
+// Verify the VPC options are consistent
+func validateNetworkOptions() error {
+	if "" == options.VPCID && len(options.SubnetIDs) <= 0 {
+		return nil
+	}
+	if "" == options.VPCID || len(options.SubnetIDs) <= 0 {
+		return fmt.Errorf("--vpc-id and --subnet-ids must be provided together")
+	}
+	if !strings.HasPrefix(options.VPCID, "vpc-") {
+		return fmt.Errorf("Invalid VPC ID: %s", options.VPCID)
+	}
+	for _, eachSubnetID := range options.SubnetIDs {
+		if !strings.HasPrefix(eachSubnetID, "subnet-") {
+			return fmt.Errorf("Invalid subnet ID: %s", eachSubnetID)
+		}
+	}
+	return nil
+}
+
+// Verify the ingress CIDR options
+func validateIngressOptions() error {
+	if len(options.AllowedWebCIDRs) <= 0 {
+		return fmt.Errorf("At least one --allowed-web-cidrs value is required")
+	}
+	for _, eachCIDR := range options.AllowedWebCIDRs {
+		if _, _, cidrErr := net.ParseCIDR(eachCIDR); nil != cidrErr {
+			return fmt.Errorf("Invalid --allowed-web-cidrs value: %s", eachCIDR)
+		}
+	}
+	if sshIngressDisabled() {
+		return nil
+	}
+	for _, eachCIDR := range options.AllowedSSHCIDRs {
+		if _, _, cidrErr := net.ParseCIDR(eachCIDR); nil != cidrErr {
+			return fmt.Errorf("Invalid --allowed-ssh-cidrs value: %s (use %s to disable SSH)",
+				eachCIDR,
+				noSSHIngress)
+		}
+	}
+	return nil
+}
+
+// Returns true if the web UI isn't open to all IPv4 addresses
+func webIngressRestricted() bool {
+	for _, eachCIDR := range options.AllowedWebCIDRs {
+		if eachCIDR == anyIPv4CIDR {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if port 22 shouldn't be opened, eg for teams that use
+// SSM Session Manager
+func sshIngressDisabled() bool {
+	if len(options.AllowedSSHCIDRs) <= 0 {
+		return true
+	}
+	return len(options.AllowedSSHCIDRs) == 1 &&
+		strings.ToLower(options.AllowedSSHCIDRs[0]) == noSSHIngress
+}
+
+// Return one tcp ingress rule per CIDR
+func cidrIngressRules(cidrs []string, port int64) []gocf.EC2SecurityGroupRule {
+	var rules []gocf.EC2SecurityGroupRule
+	for _, eachCIDR := range cidrs {
+		rules = append(rules, gocf.EC2SecurityGroupRule{
+			CidrIp:     gocf.String(eachCIDR),
+			IpProtocol: gocf.String("tcp"),
+			FromPort:   gocf.Integer(port),
+			ToPort:     gocf.Integer(port),
+		})
+	}
+	return rules
+}
+
+// Return the Concourse EC2 security group ingress rules. If Concourse is
+// fronted by a load balancer, only the load balancer can reach the web port.
+func concourseIngressRules(lb *loadBalancer) *gocf.EC2SecurityGroupRuleList {
+	var rules gocf.EC2SecurityGroupRuleList
+	if nil != lb {
+		rules = append(rules, lb.webIngress...)
+	} else {
+		rules = append(rules, cidrIngressRules(options.AllowedWebCIDRs, concourseWebPort)...)
+	}
+	if !sshIngressDisabled() {
+		rules = append(rules, cidrIngressRules(options.AllowedSSHCIDRs, sshPort)...)
+	}
+	return &rules
+}
+
+// Spread the ASG over the VPC subnets, or all the region's AZs
+func setASGPlacement(asg *gocf.AutoScalingAutoScalingGroup) {
+	if isVPCDeployment() {
+		asg.VPCZoneIdentifier = subnetIDList()
+	} else {
+		// Empty Region is equivalent to all region AZs
+		// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/intrinsic-function-reference-getavailabilityzones.html
+		asg.AvailabilityZones = gocf.GetAZs(gocf.String(""))
+	}
+}
+
+// Return the subnet IDs as a CloudFormation list
+func subnetIDList() *gocf.StringListExpr {
+	var subnetIDs []gocf.Stringable
+	for _, eachSubnetID := range options.SubnetIDs {
+		subnetIDs = append(subnetIDs, gocf.String(eachSubnetID))
+	}
+	return gocf.StringList(subnetIDs...)
+}
+
+// Add the resources that allow the EC2 instance to access the DB instance
+// and attach them to the dbInstance. VPC deployments use a VPC security
+// group with a SG-to-SG ingress rule and a DB subnet group. EC2-Classic
+// deployments use a DB security group.
+func addDBNetworkResources(template *gocf.Template,
+	dbInstance *gocf.RDSDBInstance,
+	ec2SecurityGroupResourceName string) {
+
+	dbSecurityGroupName := sparta.CloudFormationResourceName("ConcoursePostgresqlSG",
+		"ConcoursePostgresqlSG")
+
+	if !isVPCDeployment() {
+		dbSecurityGroup := &gocf.RDSDBSecurityGroup{
+			GroupDescription: gocf.String("Allow access from Concourse CI server"),
+			DBSecurityGroupIngress: &gocf.RDSSecurityGroupRuleList{
+				gocf.RDSSecurityGroupRule{
+					EC2SecurityGroupName:    gocf.Ref(ec2SecurityGroupResourceName).String(),
+					EC2SecurityGroupOwnerId: gocf.Ref("AWS::AccountId").String(),
+				},
+			},
+		}
+		template.AddResource(dbSecurityGroupName, dbSecurityGroup)
+		dbInstance.DBSecurityGroups = gocf.StringList(gocf.Ref(dbSecurityGroupName))
+		return
+	}
+
+	// VPC security group that only accepts Postgres connections from
+	// the Concourse EC2 security group
+	dbSecurityGroup := &gocf.EC2SecurityGroup{
+		GroupDescription: gocf.String("Allow access from Concourse CI server"),
+		VpcId:            gocf.String(options.VPCID),
+		SecurityGroupIngress: &gocf.EC2SecurityGroupRuleList{
+			gocf.EC2SecurityGroupRule{
+				SourceSecurityGroupId: gocf.GetAtt(ec2SecurityGroupResourceName, "GroupId"),
+				IpProtocol:            gocf.String("tcp"),
+				FromPort:              gocf.Integer(postgresPort),
+				ToPort:                gocf.Integer(postgresPort),
+			},
+		},
+	}
+	template.AddResource(dbSecurityGroupName, dbSecurityGroup)
+
+	dbSubnetGroupName := sparta.CloudFormationResourceName("ConcoursePostgresqlSubnetGroup",
+		"ConcoursePostgresqlSubnetGroup")
+	dbSubnetGroup := &gocf.RDSDBSubnetGroup{
+		DBSubnetGroupDescription: gocf.String("Concourse CI database subnets"),
+		SubnetIds:                subnetIDList(),
+	}
+	template.AddResource(dbSubnetGroupName, dbSubnetGroup)
+
+	dbInstance.DBSubnetGroupName = gocf.Ref(dbSubnetGroupName).String()
+	dbInstance.VPCSecurityGroups = gocf.StringList(gocf.GetAtt(dbSecurityGroupName, "GroupId"))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	gocf "github.com/crewjam/go-cloudformation"
+)
+
+// Add a stack output. If --export-outputs is set, the output is exported as
+// <StackName>-<name> for cross-stack references.
+// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/outputs-section-structure.html
+func addOutput(template *gocf.Template, name string, description string, value interface{}) {
+	if nil == template.Outputs {
+		template.Outputs = make(map[string]*gocf.Output)
+	}
+	output := &gocf.Output{
+		Description: description,
+		Value:       value,
+	}
+	if options.ExportOutputs {
+		output.Export = &gocf.OutputExport{
+			Name: gocf.Join("-",
+				gocf.Ref("AWS::StackName").String(),
+				gocf.String(name)),
+		}
+	}
+	template.Outputs[name] = output
+}
+
+// Return the Concourse URL expression, or nil if Concourse isn't fronted by
+// a load balancer or a Route53 record. In that case the URL is the public
+// address of the instance that the ASG launches, which isn't an attribute of
+// any stack resource. Use --domain-name to allocate an Elastic IP with a
+// stable URL.
+func concourseURLOutput(lb *loadBalancer, dns *concourseDNS) *gocf.StringExpr {
+	if nil != dns {
+		return gocf.String(dns.externalURL)
+	}
+	if nil != lb {
+		return gocf.Join("", gocf.String("https://"), lb.dnsName)
+	}
+	return nil
+}
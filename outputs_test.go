@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	gocf "github.com/crewjam/go-cloudformation"
+)
+
+// Return the provision options for a VPC deployment behind an ALB
+func newTestProvisionOptions() optionsStruct {
+	return optionsStruct{
+		VPCID:              "vpc-1",
+		SubnetIDs:          []string{"subnet-1", "subnet-2"},
+		AllowedWebCIDRs:    []string{"0.0.0.0/0"},
+		AllowedSSHCIDRs:    []string{"none"},
+		LoadBalancer:       "application",
+		CertificateARN:     "arn:aws:acm:us-west-2:123456789012:certificate/1",
+		InstanceType:       "t2.micro",
+		ASGMinSize:         1,
+		ASGMaxSize:         1,
+		DBPasswordSource:   "generated",
+		DBInstanceClass:    "db.t2.micro",
+		DBAllocatedStorage: 10,
+		DBDeletionPolicy:   "Snapshot",
+		ConcourseVersion:   "v1.3.0",
+	}
+}
+
+// Run the decorator and return the rendered template
+func decoratedTemplate(t *testing.T, provisionOptions optionsStruct) []byte {
+	savedOptions := options
+	defer func() {
+		options = savedOptions
+	}()
+	options = provisionOptions
+
+	template := gocf.NewTemplate()
+	decoratorErr := ciCDLambdaDecorator("AMILookup", "ConcourseSecurityGroup")("SpartaCICD",
+		"",
+		gocf.LambdaFunction{},
+		nil,
+		"artifacts",
+		"SpartaCICD.zip",
+		template,
+		logrus.New())
+	if nil != decoratorErr {
+		t.Fatal(decoratorErr)
+	}
+	templateJSON, templateJSONErr := json.Marshal(template)
+	if nil != templateJSONErr {
+		t.Fatal(templateJSONErr)
+	}
+	return templateJSON
+}
+
+// Run the decorator and return the rendered template's outputs
+func decoratedOutputs(t *testing.T, provisionOptions optionsStruct) map[string]string {
+	templateJSON := decoratedTemplate(t, provisionOptions)
+	var rendered struct {
+		Outputs map[string]struct {
+			Value json.RawMessage
+		}
+	}
+	renderedErr := json.Unmarshal(templateJSON, &rendered)
+	if nil != renderedErr {
+		t.Fatal(renderedErr)
+	}
+	outputs := make(map[string]string)
+	for eachName, eachOutput := range rendered.Outputs {
+		outputs[eachName] = string(eachOutput.Value)
+	}
+	return outputs
+}
+
+func TestStackOutputs(t *testing.T) {
+	outputs := decoratedOutputs(t, newTestProvisionOptions())
+	expectedOutputs := map[string]string{
+		"ConcourseURL":      "DNSName",
+		"DBEndpointAddress": "Endpoint.Address",
+		"DBEndpointPort":    "Endpoint.Port",
+		"ASGName":           "Ref",
+		"InstanceRoleARN":   "Arn",
+		"SecurityGroupID":   "GroupId",
+		"ArtifactBucket":    "artifacts",
+	}
+	for eachName, eachFragment := range expectedOutputs {
+		value, exists := outputs[eachName]
+		if !exists {
+			t.Fatalf("Missing output %s in %v", eachName, outputs)
+		}
+		if !strings.Contains(value, eachFragment) {
+			t.Fatalf("Expected output %s value %s to include %s", eachName, value, eachFragment)
+		}
+	}
+	if _, exists := outputs["WorkerASGName"]; exists {
+		t.Fatal("Unexpected WorkerASGName output without a worker pool")
+	}
+}
+
+func TestStackOutputsConcourseURL(t *testing.T) {
+	// The Route53 name is preferred to the load balancer name
+	dnsOptions := newTestProvisionOptions()
+	dnsOptions.HostedZoneID = "Z1"
+	dnsOptions.DomainName = "ci.example.com"
+	if url := decoratedOutputs(t, dnsOptions)["ConcourseURL"]; url != `"https://ci.example.com"` {
+		t.Fatalf("Unexpected ConcourseURL: %s", url)
+	}
+
+	// An Elastic IP is allocated for the Route53 record
+	eipOptions := newTestProvisionOptions()
+	eipOptions.LoadBalancer = ""
+	eipOptions.CertificateARN = ""
+	eipOptions.HostedZoneID = "Z1"
+	eipOptions.DomainName = "ci.example.com"
+	if url := decoratedOutputs(t, eipOptions)["ConcourseURL"]; url != `"http://ci.example.com:8080"` {
+		t.Fatalf("Unexpected ConcourseURL: %s", url)
+	}
+
+	// The instance's public address isn't known to the stack
+	instanceOptions := newTestProvisionOptions()
+	instanceOptions.LoadBalancer = ""
+	instanceOptions.CertificateARN = ""
+	if url, exists := decoratedOutputs(t, instanceOptions)["ConcourseURL"]; exists {
+		t.Fatalf("Unexpected ConcourseURL without a load balancer or DNS: %s", url)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	"regexp"
+)
+
+// DB instance DeletionPolicy values
+// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-attribute-deletionpolicy.html
+const (
+	dbDeletionPolicySnapshot = "Snapshot"
+	dbDeletionPolicyRetain   = "Retain"
+	dbDeletionPolicyDelete   = "Delete"
+)
+
+const (
+	defaultDBBackupRetentionDays = 7
+	maxDBBackupRetentionDays     = 35
+)
+
+var dbBackupWindowPattern = regexp.MustCompile(`^\d{2}:\d{2}-\d{2}:\d{2}$`)
+var dbMaintenanceWindowPattern = regexp.MustCompile(`^(?i:mon|tue|wed|thu|fri|sat|sun):\d{2}:\d{2}-(?i:mon|tue|wed|thu|fri|sat|sun):\d{2}:\d{2}$`)
+
+// Verify the RDS options
+func validateDBOptions() error {
+	switch options.DBDeletionPolicy {
+	case dbDeletionPolicySnapshot, dbDeletionPolicyRetain, dbDeletionPolicyDelete:
+	default:
+		return fmt.Errorf("Unsupported --db-deletion-policy value: %s", options.DBDeletionPolicy)
+	}
+	if options.DBBackupRetentionDays < 0 || options.DBBackupRetentionDays > maxDBBackupRetentionDays {
+		return fmt.Errorf("--db-backup-retention must be between 0 and %d days",
+			maxDBBackupRetentionDays)
+	}
+	if "" != options.DBBackupWindow && !dbBackupWindowPattern.MatchString(options.DBBackupWindow) {
+		return fmt.Errorf("Invalid --db-backup-window value (expected hh24:mi-hh24:mi): %s",
+			options.DBBackupWindow)
+	}
+	if "" != options.DBMaintenanceWindow && !dbMaintenanceWindowPattern.MatchString(options.DBMaintenanceWindow) {
+		return fmt.Errorf("Invalid --db-maintenance-window value (expected ddd:hh24:mi-ddd:hh24:mi): %s",
+			options.DBMaintenanceWindow)
+	}
+	if "" == options.DBRestoreSnapshotID {
+		return nil
+	}
+	if options.DBEncrypted || "" != options.DBKMSKeyID {
+		return fmt.Errorf("A restored DB instance inherits the snapshot's encryption settings")
+	}
+	// A generated password doesn't match the snapshot's master password
+	if dbPasswordSourceSecretsManager != options.DBPasswordSource {
+		return fmt.Errorf("--restore-from-snapshot requires --db-password-source %s with the secret of the snapshot's master password",
+			dbPasswordSourceSecretsManager)
+	}
+	return nil
+}
+
+// Apply the encryption, availability, backup and restore options to the
+// DB instance
+func configureDBInstance(dbInstance *gocf.RDSDBInstance) {
+	dbInstance.MultiAZ = gocf.Bool(options.DBMultiAZ)
+	dbInstance.BackupRetentionPeriod = gocf.String(fmt.Sprintf("%d", options.DBBackupRetentionDays))
+	if "" != options.DBBackupWindow {
+		dbInstance.PreferredBackupWindow = gocf.String(options.DBBackupWindow)
+	}
+	if "" != options.DBMaintenanceWindow {
+		dbInstance.PreferredMaintenanceWindow = gocf.String(options.DBMaintenanceWindow)
+	}
+	if "" != options.DBEngineVersion {
+		dbInstance.EngineVersion = gocf.String(options.DBEngineVersion)
+	}
+	if "" != options.DBRestoreSnapshotID {
+		// The database name and master username come from the snapshot. The
+		// MasterUserPassword references the existing secret with the
+		// snapshot's password, which validateDBOptions requires.
+		// Ref: http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-properties-rds-database-instance.html#cfn-rds-dbinstance-dbsnapshotidentifier
+		dbInstance.DBSnapshotIdentifier = gocf.String(options.DBRestoreSnapshotID)
+		dbInstance.DBName = nil
+		dbInstance.MasterUsername = nil
+		return
+	}
+	if options.DBEncrypted || "" != options.DBKMSKeyID {
+		dbInstance.StorageEncrypted = gocf.Bool(true)
+		if "" != options.DBKMSKeyID {
+			dbInstance.KmsKeyId = gocf.String(options.DBKMSKeyID)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateDBRestoreOptions(t *testing.T) {
+	savedOptions := options
+	defer func() {
+		options = savedOptions
+	}()
+	testCases := []struct {
+		name           string
+		passwordSource string
+		encrypted      bool
+		valid          bool
+	}{
+		{"generated password", dbPasswordSourceGenerated, false, false},
+		{"snapshot password secret", dbPasswordSourceSecretsManager, false, true},
+		{"encrypted", dbPasswordSourceSecretsManager, true, false},
+	}
+	for _, eachCase := range testCases {
+		options = newTestProvisionOptions()
+		options.DBRestoreSnapshotID = "concourse-final-snapshot"
+		options.DBPasswordSource = eachCase.passwordSource
+		options.DBPasswordSecretID = "SpartaCICD/db-password"
+		options.DBEncrypted = eachCase.encrypted
+		validateErr := validateDBOptions()
+		if eachCase.valid != (nil == validateErr) {
+			t.Fatalf("%s: expected valid=%t, got %v", eachCase.name, eachCase.valid, validateErr)
+		}
+	}
+}
+
+func TestDBRestorePasswordWiring(t *testing.T) {
+	restoreOptions := newTestProvisionOptions()
+	restoreOptions.DBRestoreSnapshotID = "concourse-final-snapshot"
+	restoreOptions.DBPasswordSource = dbPasswordSourceSecretsManager
+	restoreOptions.DBPasswordSecretID = "SpartaCICD/db-password"
+
+	var rendered struct {
+		Resources map[string]struct {
+			Properties map[string]json.RawMessage
+		}
+	}
+	renderedErr := json.Unmarshal(decoratedTemplate(t, restoreOptions), &rendered)
+	if nil != renderedErr {
+		t.Fatal(renderedErr)
+	}
+	if _, exists := rendered.Resources["ConcourseDBPasswordSecret"]; exists {
+		t.Fatal("Unexpected generated password secret for a restored DB instance")
+	}
+	dbProperties := rendered.Resources["ConcoursePostgresql"].Properties
+	if string(dbProperties["DBSnapshotIdentifier"]) != `"concourse-final-snapshot"` {
+		t.Fatalf("Unexpected DBSnapshotIdentifier: %s", dbProperties["DBSnapshotIdentifier"])
+	}
+	for _, eachProperty := range []string{"DBName", "MasterUsername"} {
+		if value, exists := dbProperties[eachProperty]; exists && string(value) != "null" {
+			t.Fatalf("Unexpected %s for a restored DB instance: %s", eachProperty, value)
+		}
+	}
+	// Both the instance and the web node use the snapshot's secret
+	masterUserPassword := string(dbProperties["MasterUserPassword"])
+	if !strings.Contains(masterUserPassword, "{{resolve:secretsmanager:") ||
+		!strings.Contains(masterUserPassword, "SpartaCICD/db-password") {
+		t.Fatalf("Unexpected MasterUserPassword: %s", masterUserPassword)
+	}
+	launchConfigJSON, _ := json.Marshal(rendered.Resources["ConcourseCIASGLaunchConfig"].Properties)
+	if !strings.Contains(string(launchConfigJSON), "POSTGRES_PASSWORD_SECRET_ID=SpartaCICD/db-password") {
+		t.Fatalf("The userdata doesn't read the snapshot's secret: %s", launchConfigJSON)
+	}
+}
@@ -188,34 +188,87 @@ var _escData = map[string]*_escFile{
 
 	"/resources/source/userdata.sh": {
 		local:   "resources/source/userdata.sh",
-		size:    4978,
-		modtime: 1465445693,
+		size:    8906,
+		modtime: 1792228205,
 		compressed: `
-H4sIAAAJbogA/9RY627bOhL+r6dgnQDd7ZaSnaRuY0CL9a2t0cQ2JLtFURQqLTGWEEkUSMqx2+bddyjJ
-tuTYiQ9witMbGpGcGQ5nvm+GzMkzYxbExowIH+El1bqjYXc0tey+0xt9Gl6N2j1nal2ZvpSJaBnGPJB+
-OtNdFhkui12WckEzA5yGlAgqDI/dxSEjnrFo6Od6HXNXf32+FXbCIE6XDom85oU2nnauBl3n/cieDNvX
-ffMbdc8iKolHJEEYJ+ksDFzsMyFjEtFv2tgafGxP+s5g7LR7PWtXPmQuCXGQLC6+aaWDdNo2bNKeTt47
-U7tvZTv9+IH0qaBc2UX39/ulx23b/jSyepn0mAhxx7inpO1x25q0ne6g23M6g2Hb+gyyk/em4bOIGuks
-jWVqKCWb8kXg0mG+ix6SaOYRvTg8nPqd1bezo/Rt2/yBam/jVusdlW0pa6iFvqCaMtLrDGIhSexSiwoI
-4sZeDb1EtX7sJSyIpd72PE6FqKGv6H5rHA427Hcng9HQsSfWYPjOrJpUQQBTreps6bD/O9111KjK9iD4
-AJ+1U5p28jf/0U4Q/JtQIamHWIymWXxRo6nXLzS12r4etFAR9SAic0Chv4iwEF6RCwB2HAA0MhWchR/D
-uReU47N6o1l/BQsN9C8SBbjenF1eNJvNf2vBDSTgGcI3qFbJawqaCnC68CHWmvRprCHkpjxEeCGQYgoQ
-pdG81M9eXejFTyMkEg6QKeMcrgwdMqvM+RHz0H+Wj8mQROI5lShQiQhDJNJEwU0wjvBKuwkgE2hQrFE4
-60r6QTzXRI7JsriQLEE/fz5hcb2aJuADhRlUmppz4lXn9hghd8INA5TG34MEQSlRVn8FXEYpR1CGEBQm
-wsHxO4HEOXIT+B9SkxHzvJO6t+Dl/X0x/kBXMKjGmyQJFCAiAxbr4LKWO76buR0phL3KurbJ5emBuvFL
-YtBdV9zu4CCUN1V5H5DxFTrd3w0eRGBjBx2EbklEIZNH4M2iKvLilq5eaEL4GD7mNEZYIi6Icrsip/qB
-AyIID9Hz5+gIDShlt5T/NR3oZQIy6ohgHgNtysoApAPmdWhZO+BIpc948J16zlZM/JKM29Nx3/o4sEcW
-DKz+29a6Fm0Z6OmMzw2FDujWMUslEhQy4wFLkBdw6koGfIlu4RvhBPJDpVtSV1m80T1Icqlhfup3nO3W
-quG8NWtfEs6gJEStbeO/o7OvGlwcIhJ75gFsgAz0cegm0PZV5HC67tGnj/bzqlKy7l77ldZtHZSKJOMi
-yQoSR6AAS0GyW8lD+S02M6Ft9pWoOAYa6t4DRubQy7NGgfOWj9aTkM/Tw90dtOlSqpiFWBG5QMDpzk2r
-9ab+pq52otCOKnLVG1Ymp8VpBOl0hdnQNiAxDRklWsIDOIFcmZeXlxqcB3wkXJqSpzQbgr/ZRBrTZQKK
-1NOyCUAdWKvnA04lD6gwzzW6DKTLPPiuvzzTVFdScSehOelb19n4jgQlZQaZnnOWJuYNCQXVboMwrM4o
-/JhFHRbSA8Q7IZvfBCE1jQXhBgyMCkR1mNmRdCKynK2gfZuN687u2oy4t2lS+JOtuNAAU75fC9pwLIVD
-YzILqVf4yGkeVQeEKOfFbD7YeFt1ElbWjpaEHmxZXqs6qlYOOarW9jpa06jrM1Q7fZT8NfTfA3VjJ9Jq
-Uitf1IGUH/rWccUkI8zT9SQTA6CrD6yqmsESWXq6bATWlEaNs9d6Hf42isniEXKQ6VnJL2RzaxhYsYAb
-0kOdLc3/eE5xxuQxjMpO/AeQKvfz9+HVXiocR638KDm7NjdOB66c9udh9xF2iQSAQ8Qqdre8OnRlRUoM
-UH98fz6yKf/xxHii2WyD/LuSouThP0yHJ8H7CB9Kp8iZcILGRLo+PFURvHRKt13YC56K2Cp+g9DKf1Sf
-cOp2rdADyvZmq30v6QKD6jG9950Na/8PAAD//1VdgZFyEwAA
+H4sIAAAAAAAC/90Za3PbNvI7f8WG8Zyt1qTkR3yNOuqcLCmJJo6kIeWkGY+HhkhI4pmvA0DZbtL/fguQ
+lCiZsnXXZK69pmMbwO5ise9dvnxRn/hRfUL4HIx7qnWGg87w0rJ7Tnf4aXAxbHedS+uiNRci4c16feaL
+eTox3Tisu3HkxinjVBFgNKCEU1734rsoiIlX//IFzE4B85Ey7scR/P77Cs8J/Ci9d0jonZ2W7rXftY9f
+nbXW0LM9xC7DnSjO1uFOcEuCjS7PL/od593QHg/aH3qtG+oeh1QQjwgChpGkk8B3jXnMRURCeqONrP7H
+9rjn9EdOu9u1NuGD2CWB4SeL05sSB71fxz1r0L5Y8tG7F5RFJMiZGNtt533vs+3YvY7VGzv9roLC7ff0
+gdvUZVT0uxLSHrfHl7YzalvILBJ1RlbvTf9XBW4LIlI+IgwZRfIjRqf+vUQqcXLetvG17cvxO+fSljzh
+kyXuJZf8hHRdciXoUdu2Pw2tjLER4fwuZp7iCHkZt51Ov9N1zvuDtvUZYcfvWvV5HNJ6OkkjkSoV25Qt
+fJcOslvMgIQTj5iZUtufbMfqve0PB60voFt0qkMTdNxtNi06Q3vQAVWFOnpr9Wwl+J5tS9A3UbP5loq2
+EBLjCnR5U/e8H3FBIpdalKO6l5fqcAh6L/KS2I+E2fY8RjnX4bpMvHjohi6658Wjy+pAUY2t4YUzumgP
+ehsYaGuCxcEoIBEt42gvv/F/2kvA/8eUC+oBus6lkjkcnZmNU02etj/0m5Brwg/JDJ1vvggNzr1cP+jP
+kY92q1AMpRIDDWJBmXHcODprvMKDIzggoW80ziavT8/OzmqaP0V5vwBjCvqarlPElN5g8jmKVhNzGmkA
+bsoCMBYcZIDA+HB09to8fnVq5r/rARH4AIVsZL4Uwzayktw8jD348f4pGJIIY0YF+NIYggB4mkgT5DED
+40Gb+qgJ6OdnFN/6IOZ+NNN4ZqdlcC7iBL5+fYZicZomyAPFHShtzRjx1vcqiCTIQhydGImfQBr9hj8x
+jErSqN45Bc/naFFA7rgb+ODFlEf7QuInMROQ2RiHDyRCFTMNiZwsLzGMgoUMW0MLRQWabc5j10d2c2do
+sxmXRvoSOgHxQ0DtQS8gXPgu9EdquYyh0B3YwKgrA4HyKA5EaEgfMCYCKSgbJCONPDDly7C3cnfc9HNf
+NXwPNqJp6egGpE9tYxfPaOR9L+/qIjeY9ygkRdwzYEqFO0d/IwImcYxaMIUJvtjnEOEqIaiQeKrkVRgl
+GpZAi30caVo3UmY8U1+YaQ/QQoxsy1iQIKXbpJfDoOz0vSdimI6g/0rRxnMzsQVDW8fNOBVJKkDQewFf
+CwMEw4V9P1Rm9U8eR4f8gf8MCaKIA7k2Zd4+wE2TC8+Pald6IRn9urZ/s3oixsdBrzNGVh17bPUHb1vr
+8VmmHdRa8zHr/9jbDPf1ddRCKXlo/y6Kz0M4JDKGo9LRkpVK8V70B5KKOaAwPRoJjJ4cRKxOM5XAHVZA
+co10ZjSijMjw3B71EeyWRpnB4PHDPqOPbEbQMJERsTLBfDN72ZK9drSVp4uKvSeP4ekaY+/J461WGvPM
+ULM3tqostTg0syB9kOZ1TyvmJo0WPoujK/1J1vXrw2UceB6r4Bn9Ys2BvDRM+EHGS026TIVKUdbfUqU5
+GM+0WQ2qwy9Q9+iiHqVBoAKWcf9dPGuYMsD6H7AjIOwhe/0JuAn+xOJAlYsn56l7ixxgJ5CtsRbGxXrG
+J0mC9TkRKBUT86WWZc3N2mEDCgxv7VxbVhN7W6rZ7xVdskTa6W8tppY9UKmUUrBGlKlwrceRQAA5GMBK
+qpWW8wgdqq82i04NidKAU0W7qOemYFyUKZWbwUd6qCSJhdiWN6lebuNNCPgC64t5XAEKz92mY9jic4Kg
+PA1l+DAUzSVxyCn3LGtoNUuVTmamkF8T+uijmP5N6N0n1JVxvYLtX/52nBNleNd0sYMoFAf3WPIdqYWS
+jPoRPou95XxrqbyEAFUJV7H4wy19+EFbaeZxl1oyypdgUQymKnshHpdyxtS4zIKA8fJWBrUY86nKfQRr
+R0xyLg0xf8IdnSgqUSxrVNelCZaTEg/lgdUnRqyMADdVKZznWB9rzTARD1gtCz9Q8FOfcaFIIcmMnCzQ
+uKnlDvHH82aVIP5QeVUkLim4LWnrKk5odID5Rv1eDxI6/AgyiR0Cng+dT9ZwcPEZr1Mr5LA9LhZj63LQ
+OYRGfNZo1LAXvtNr5h3zMRHKq68kkesaTLEVUcMAH8sU5IGw2eLqqHktna/Yl/DXP6tjabEHDXmIncZB
+GWArpZoKJHBU2wc5WnEQePmHmaSTXNlqf/WnOsE2bLuxoilfySC6drS84Voicz43cIElGRgCGCfb4Y0B
+7O9DBcUSdzvSLGHkVJ/H4djgoCE63J9FaE1lZAzpW8grGa0nPyxTY+b/Rj1nBcZ39+uRHIHx+cqzSZRV
+wYgHRW8nFb3h5Yi8OSzb29jYzSE83xUHB7mBb7f+mskoOk1tu/3WMoJXuuDEkVrWr9cquA3u9OuKkk0S
+qP03ZgvfqMKrDj7rxd3UDyiWUaqSUwFkraxTk49vX87Yl6Oe9bFvDy1cWL03zWLUsxpweGbMZnU1XKAk
+wtgoBRJHnsytns8wlcZYDIa3+DcYCXo4NtkldJm0pqZMlLIpj+XwQzBMIMryuueAxxHSkPLLBFG03Kvk
+/Kl37qwYlf3pm5Z+lbB4xkjYXE2cMXdca24coqa81pbEKfOLYahe0JBOZhTNBDzT/KwhLWcKzzQ9Uscq
+Hhh5PJDRY4eAYaCxq/n1Y/hVoFNAq0BhKD/fIYrICTkSmWEMUFM7Ixu3QrGJ2t/bPgxAbJoPwg1ZTu5V
+T8zlJZQyBZKb1GYgaf7U+KmhReihLHZ560hbWlOrLsJEQzdG5sVD6/Xr1xo+BdnDbrslWErVEllVG2lE
+84pOUxtonkitkS3QwZhPeetEkxnPxcqCtxqHx5qcDkqRk6CFTH9Q6zvil5BjVPKMxWnSmhJZQN/6QbC+
+I02nlXcj6LHoGk4Qz6Qft+oLwuq4qK9ZJ1YIsw1IJyT3kweBXB19ON88mxD3Nk1yftSJSxKRsmosusCa
+jDs0IpOAejmPWM4pqToIRBnLd7PFktt1JvGkYLQE9OjK8tk6o/JkG6PyrJJRXXvUIFT4vep1KwPMhqTl
+ZtELZ8U0Vk//AaqWD1vlkKfqm06Jy6H1vmftFqCUEz4fo7J8bBjyD0PG1XqciNInuSVAESbg6PjvZgP/
+HeWb+SewrdFDpbccNqNmoLst5OT3Ec4qdPzlnZVhU7GLq6oX/wW8NePzz+Owla6wm89mT1G+V/owsBzt
+OJ2uY38edJ7wMy6HsYQ/RO7Kw7bNhkCCyQ8sO2f/3VP+jumRqy+/SDf/9IsOqL797m35XCxRToxJNl/b
+GLb9v2fRlWr/rE5Z4vB/7I7PuswT/lh6RZYFsZOUQzNIE1Wvr+p9vOsOm2Ar/0TdzH6tT2hlfyGtB5Ht
+5VVVn2pzG1RdedWHXDz7N0Bf2/XKIgAA
+`,
+	},
+
+	"/resources/source/worker_userdata.sh": {
+		local:   "resources/source/worker_userdata.sh",
+		size:    3876,
+		modtime: 1792228205,
+		compressed: `
+H4sIAAAAAAAC/81WbW/aSBD+7l8xdapLULENSRsptK6UI/SKkobKkEZVErmLvYAvtte3u+ZFbf/7zS4G
+TDCX+3CVDkWBnXlmdnbeD144wyh1hkRMwJpTo927bvduvH7Hv+jdXl/1zi/8G+/KnUiZiZbjjCM5yYd2
+wBInYGnAci6oVsBpTImgwgnZLI0ZCZ3v38FurzBfKBcRS+Hnz42cH0dpPvdJEp6+Lt3b/3h+/ObU3RJf
+0lC6jDvRlm3jTpCkYOe3fd/r/NHtXbvfwfToyIQWmEhttTw6RktM+GkM+uf+Zedr3+932l5n4HcvtDYk
+X9KF6NOAU9m9UOqMg//4YxwA/q3thhnjj5SDnBAJHA0UEh0GM/Q20pBNh5CykB4KQOtsGJRoqCfLh3Ek
+JlRoMCKWlAAe6aK+VLDUn/FoSiRVdCBpCJEUQMKQUyFQjWQr+SduAaF9YRvK7gFF40LAYN4M81Tm0Dy1
+G6+NaAR38AKsEZjOhCXUyTXXyQXlIZHEFhMTHgy8IDUAgpzHYE0FqMTCvGqentnHb17bxbcTo5VCamFL
+SYPFYJ9apW6SsBBezf8JQzJpjamEKBWSxDGIPKN8GgnGwVoYowiDDN2CR6eUL+QkSseGUKCAluFCsgx+
+/HhG44qbZ6FyubWAEmnMSbhNq1CSoQksPbGyKFMK8etkDbOslRIyE0Ec/ZIUXednu7s3vutyLkVXY60U
+zJdPy1WBAAoYKNtBnECA77O4rkt4uSld2BGH6qvtVdNBpTQWVOtepdgIrKuypnJf20mrSpWYG3vepNvS
+kzch8AXQYMIqoPDcbSb8ADEhCBV5AlYAlta5Vg6F5o7n9bxWqYFgDyZ8AcU1SSQSIoOJDZ15RgNVrxVm
+v//tuFDK8a7R9F+4QlswjyQ09UF7Rv9LnpXew99bvWsEFMV5S/DeEeNbHVE1raL9aTp2NmGgfBQvk0s3
+LnRGSsbY/7DQrCXJmpI4p9VpZ60wUYgx3G2HJiL+yqlyt8b1JcdOgUSWyyyXIOlcYhyL8lVRPIySjHEJ
+fwqW1pmoi4V4q011FcVW7jlCmi1kGKW1t3DHMpoeMWHr7+2CM+EVpCShdUB+z7/1etdXX/E6fUILzwer
+w8C7uW7XocFOG41aHcyZWbNnPJL0SF19p5Q81LRH1U9sLaBsIHw8vWu2HlQir+gK//BWs1X0jxqKiW3o
+qAzYq6mmixKatUOYMCF9BNsYs2IoqaMRMswDEVOaQfMNnlKqIj7YTK6YsUeBjVMHGUub01TqSVeML6Ak
+wAyI1O0SOzThONqELW08oqYRi2OG+UBwumYxCWii5NcjNMCx+35P+vlLC3CIwLt3h7c977Lj+f221/08
+ODQOyusT1RvFx15/4H77vyafzjxcA1J5VJV6d6YUxFdRMh9qh98MOqfBvrIsImNZ6ocVRhwclsnSXrgG
+oE5L6YSXKwcVRG3XMX5WZ722WGo92bp0K22W0KVyq9hodkVKybUVM+OZbrMJ9y8Zqf2bzx3vS7ff8/Dg
+dT60VhvQZu6HNuNjx0gelUutDBsrlUGJr2wd2aFR2oVXL1wr95H3wTXvMs5wS0haT5/3YOAKj4kZus96
+gabTiLNUFYxbWqvvzVLW3pv1imX6vip/700jzRO0KxBu08An4nhifOE6MskMjCbDBrVwz87ODJJLpgvZ
+lTyn+oiVviEsi5wqPY3lAcuBR1SdGw1DNaoAi1u4jfqxoXY2EY1TEruDjvdJn2c4UDbyLCNizFmeuSOi
+dojHKI63KWqfdDljEtEhlpsfs/EoiqnrTAl38LDrPyQ+AfsJmQ8XUln56fenvCEJHvOsMEhzAtwPc14t
+hVtqKoVPUzKMaVgYyenSpz6CKOcFdXlYG7xjJzJXtpZwO7eWedu2Ks4+WxWv0lbT2NmTqjPZVN25sgp2
+Xa7oanj0VUbgwOivRap2+SKj1Dpfuekjz/gbnFrATiQPAAA=
 `,
 	},
 
@@ -1,13 +1,20 @@
 #!/bin/bash -xe
-CONCOURSE_DOWNLOAD_URL=https://github.com/concourse/bin/releases/download/v1.3.0-rc.73/concourse_linux_amd64
+CONCOURSE_DOWNLOAD_URL=https://github.com/concourse/bin/releases/download/{{ .ConcourseVersion }}/concourse_linux_amd64
+CONCOURSE_SHA256={{ .ConcourseSHA256 }}
+CONCOURSE_S3_URL={{ .ConcourseS3URL }}
 PUBLIC_HOSTNAME=`ec2metadata --public-hostname`
 PRIVATE_IP_ADDR=`ec2metadata --local-ipv4`
+CONCOURSE_EXTERNAL_URL={{ .ExternalURL }}
+TSA_KEYS_SECRET_ID={{ .TSAKeysSecretID }}
+STATUS_PARAMETER_PREFIX={{ .StatusParameterPrefix }}
 
 CONCOURSE_BASIC_AUTH_USERNAME={{ .Username }}
 CONCOURSE_BASIC_AUTH_PASSWORD={{ .Password }}
 SPARTA_CICD_BINARY_PATH=/home/ubuntu/{{ .ServiceName }}.lambda.amd64
+AWS_REGION={ "Ref" : "AWS::Region" }
 POSTGRES_ADDRESS={ "Fn::GetAtt" : [ "{{ .DBInstanceResourceName }}" , "Endpoint.Address" ] }
-POSTGRES_CONNECTION_STRING={{ .DBInstanceUser }}:{{ .DBInstancePassword }}@$POSTGRES_ADDRESS/{{ .DBInstanceDatabaseName }}
+POSTGRES_PASSWORD_SECRET_ID={{ .DBPasswordSecretID }}
+CONTROL_PLANE_SECRET_ID={{ .ControlPlaneSecretID }}
 
 ################################################################################
 # 
@@ -25,7 +32,26 @@ fi
 service supervisor stop || apt-get install supervisor -y
 apt-get update -y 
 apt-get upgrade -y 
-apt-get install supervisor awscli unzip git -y
+apt-get install supervisor python3-pip unzip git -y
+# The distro awscli doesn't support Secrets Manager
+pip3 install --upgrade awscli
+{{ if .AssociateAddressArgs }}
+# Claim the Elastic IP the Concourse DNS record points at
+aws ec2 associate-address --region $AWS_REGION --instance-id `ec2metadata --instance-id` {{ .AssociateAddressArgs }}
+{{ end }}
+
+################################################################################
+# Database password - fetched at boot s.t. it's not part of the userdata
+set +x
+POSTGRES_PASSWORD=`aws secretsmanager get-secret-value --region $AWS_REGION --secret-id "$POSTGRES_PASSWORD_SECRET_ID" --query SecretString --output text | python3 -c 'import json,sys; print(json.load(sys.stdin)["password"])'`
+POSTGRES_CONNECTION_STRING={{ .DBInstanceUser }}:$POSTGRES_PASSWORD@$POSTGRES_ADDRESS/{{ .DBInstanceDatabaseName }}
+
+################################################################################
+# Control plane - add the basic auth credentials to the secret with the
+# generated API token s.t. they're not part of the template
+CONTROL_PLANE_SECRET=`aws secretsmanager get-secret-value --region $AWS_REGION --secret-id "$CONTROL_PLANE_SECRET_ID" --query SecretString --output text | CONCOURSE_BASIC_AUTH_USERNAME=$CONCOURSE_BASIC_AUTH_USERNAME CONCOURSE_BASIC_AUTH_PASSWORD=$CONCOURSE_BASIC_AUTH_PASSWORD python3 -c 'import json,os,sys; secret=json.load(sys.stdin); secret.update(username=os.environ["CONCOURSE_BASIC_AUTH_USERNAME"], password=os.environ["CONCOURSE_BASIC_AUTH_PASSWORD"]); print(json.dumps(secret))'`
+aws secretsmanager put-secret-value --region $AWS_REGION --secret-id "$CONTROL_PLANE_SECRET_ID" --secret-string "$CONTROL_PLANE_SECRET" > /dev/null
+set -x
 
 ################################################################################
 # Our own binary
@@ -37,15 +63,42 @@ chmod +x $SPARTA_CICD_BINARY_PATH
 # ConcourseCI
 if [ ! -f "/home/ubuntu/concourse" ]
 then
-  curl -vs -L $CONCOURSE_DOWNLOAD_URL -o /home/ubuntu/concourse 
+  if [ -n "$CONCOURSE_S3_URL" ]
+  then
+    aws s3 cp --region $AWS_REGION $CONCOURSE_S3_URL /home/ubuntu/concourse.download
+  else
+    curl -vsf -L $CONCOURSE_DOWNLOAD_URL -o /home/ubuntu/concourse.download
+  fi
+  if [ -n "$CONCOURSE_SHA256" ]
+  then
+    if ! echo "$CONCOURSE_SHA256  /home/ubuntu/concourse.download" | sha256sum -c -
+    then
+      echo "ERROR: Concourse binary SHA256 mismatch. Expected $CONCOURSE_SHA256" >&2
+      rm -fv /home/ubuntu/concourse.download
+      exit 1
+    fi
+  fi
+  mv /home/ubuntu/concourse.download /home/ubuntu/concourse
   chmod +x /home/ubuntu/concourse 
 fi
 
 rm -fv /home/ubuntu/*key*
-ssh-keygen -t rsa -f /home/ubuntu/host_key -N '' 
-ssh-keygen -t rsa -f /home/ubuntu/worker_key -N '' 
+if [ -n "$TSA_KEYS_SECRET_ID" ]
+then
+  # Reuse the keys shared with the worker pool s.t. a replacement web
+  # node accepts the existing workers. The secret is empty until the first
+  # web node boots.
+  aws secretsmanager get-secret-value --region $AWS_REGION --secret-id "$TSA_KEYS_SECRET_ID" --query SecretString --output text | python3 -c 'import json,os,sys; keys=json.load(sys.stdin); [open(os.open("/home/ubuntu/" + name, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0o600), "w").write(keys[name]) for name in sys.argv[1:] if name in keys]; sys.exit(0 if all(name in keys for name in sys.argv[1:]) else 1)' host_key host_key.pub worker_key worker_key.pub || rm -fv /home/ubuntu/*key*
+fi
+[ -f /home/ubuntu/host_key ] || ssh-keygen -t rsa -f /home/ubuntu/host_key -N '' 
+[ -f /home/ubuntu/worker_key ] || ssh-keygen -t rsa -f /home/ubuntu/worker_key -N '' 
 ssh-keygen -t rsa -f /home/ubuntu/session_signing_key -N '' 
 cp /home/ubuntu/worker_key.pub /home/ubuntu/authorized_worker_keys
+if [ -n "$TSA_KEYS_SECRET_ID" ]
+then
+  # Publish the keys and the TSA address for the worker pool
+  PRIVATE_IP_ADDR=$PRIVATE_IP_ADDR python3 -c 'import json,os,sys; keys=dict((name, open("/home/ubuntu/" + name).read()) for name in sys.argv[1:]); keys["tsa_host"]=os.environ["PRIVATE_IP_ADDR"]; print(json.dumps(keys))' host_key host_key.pub worker_key worker_key.pub | aws secretsmanager put-secret-value --region $AWS_REGION --secret-id "$TSA_KEYS_SECRET_ID" --secret-string file:///dev/stdin > /dev/null
+fi
 
 ################################################################################
 # SUPERVISOR
@@ -53,8 +106,10 @@ cp /home/ubuntu/worker_key.pub /home/ubuntu/authorized_worker_keys
 # Cleanout secondary directory
 mkdir -pv /etc/supervisor/conf.d
   
+# Don't trace the DB connection string
+set +x
 CONCOURSE_WEB_SUPERVISOR_CONF="[program:concourse_web]
-command=/home/ubuntu/concourse web --basic-auth-username $CONCOURSE_BASIC_AUTH_USERNAME --basic-auth-password $CONCOURSE_BASIC_AUTH_PASSWORD --session-signing-key /home/ubuntu/session_signing_key --tsa-host-key /home/ubuntu/host_key --tsa-authorized-keys /home/ubuntu/authorized_worker_keys --postgres-data-source postgres://$POSTGRES_CONNECTION_STRING --external-url http://$PUBLIC_HOSTNAME:8080 --peer-url http://$PRIVATE_IP_ADDR:8080
+command=/home/ubuntu/concourse web --basic-auth-username $CONCOURSE_BASIC_AUTH_USERNAME --basic-auth-password $CONCOURSE_BASIC_AUTH_PASSWORD --session-signing-key /home/ubuntu/session_signing_key --tsa-host-key /home/ubuntu/host_key --tsa-authorized-keys /home/ubuntu/authorized_worker_keys --postgres-data-source postgres://$POSTGRES_CONNECTION_STRING --external-url $CONCOURSE_EXTERNAL_URL --peer-url http://$PRIVATE_IP_ADDR:8080
 numprocs=1
 directory=/tmp
 priority=999
@@ -81,8 +136,11 @@ stderr_capture_maxbytes=1MB
 stderr_events_enabled=false
 "
 echo "$CONCOURSE_WEB_SUPERVISOR_CONF" > /etc/supervisor/conf.d/concourse_web.conf
+set -x
+chmod 600 /etc/supervisor/conf.d/concourse_web.conf
 
 
+{{ if not .TSAKeysSecretID }}
 CONCOURSE_WORKER_SUPERVISOR_CONF="[program:concourse_worker]
 command=/home/ubuntu/concourse worker --work-dir /opt/concourse/worker --tsa-host 127.0.0.1 --tsa-public-key /home/ubuntu/host_key.pub  --tsa-worker-private-key /home/ubuntu/worker_key
 numprocs=1
@@ -111,9 +169,10 @@ stderr_capture_maxbytes=1MB
 stderr_events_enabled=false
 "
 echo "$CONCOURSE_WORKER_SUPERVISOR_CONF" > /etc/supervisor/conf.d/concourse_worker.conf
+{{ end }}
 
 SPARTA_CI_CD_SYNC_SUPERVISOR_CONF="[program:spartasync]
-command=$SPARTA_CICD_BINARY_PATH sync --username $CONCOURSE_BASIC_AUTH_USERNAME --password $CONCOURSE_BASIC_AUTH_PASSWORD
+command=$SPARTA_CICD_BINARY_PATH sync --username $CONCOURSE_BASIC_AUTH_USERNAME --password $CONCOURSE_BASIC_AUTH_PASSWORD --external-url $CONCOURSE_EXTERNAL_URL --status-parameter-prefix $STATUS_PARAMETER_PREFIX --s3-bucket {{ .S3Bucket }}
 numprocs=1
 directory=/tmp
 priority=999
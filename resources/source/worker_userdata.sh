@@ -0,0 +1,103 @@
+#!/bin/bash -xe
+CONCOURSE_DOWNLOAD_URL=https://github.com/concourse/bin/releases/download/{{ .ConcourseVersion }}/concourse_linux_amd64
+CONCOURSE_SHA256={{ .ConcourseSHA256 }}
+CONCOURSE_S3_URL={{ .ConcourseS3URL }}
+AWS_REGION={ "Ref" : "AWS::Region" }
+TSA_KEYS_SECRET_ID={{ .TSAKeysSecretID }}
+
+################################################################################
+# 
+# Concourse worker that registers with the web node's TSA. The web node
+# publishes the TSA public key, the worker private key and its address
+# to the TSA_KEYS_SECRET_ID secret.
+#
+# Tested on Ubuntu 16.04
+if [ ! -f "/home/ubuntu/userdata.sh" ]
+then
+  curl -vs http://169.254.169.254/latest/user-data -o /home/ubuntu/userdata.sh
+  chmod +x /home/ubuntu/userdata.sh
+  apt-get install supervisor -y
+fi
+
+# Install everything
+service supervisor stop || apt-get install supervisor -y
+apt-get update -y 
+apt-get upgrade -y 
+apt-get install supervisor python3-pip -y
+pip3 install --upgrade awscli
+
+################################################################################
+# ConcourseCI
+if [ ! -f "/home/ubuntu/concourse" ]
+then
+  if [ -n "$CONCOURSE_S3_URL" ]
+  then
+    aws s3 cp --region $AWS_REGION $CONCOURSE_S3_URL /home/ubuntu/concourse.download
+  else
+    curl -vsf -L $CONCOURSE_DOWNLOAD_URL -o /home/ubuntu/concourse.download
+  fi
+  if [ -n "$CONCOURSE_SHA256" ]
+  then
+    if ! echo "$CONCOURSE_SHA256  /home/ubuntu/concourse.download" | sha256sum -c -
+    then
+      echo "ERROR: Concourse binary SHA256 mismatch. Expected $CONCOURSE_SHA256" >&2
+      rm -fv /home/ubuntu/concourse.download
+      exit 1
+    fi
+  fi
+  mv /home/ubuntu/concourse.download /home/ubuntu/concourse
+  chmod +x /home/ubuntu/concourse 
+fi
+
+# Wait for the web node to publish the keys
+until aws secretsmanager get-secret-value --region $AWS_REGION --secret-id "$TSA_KEYS_SECRET_ID" --query SecretString --output text | python3 -c 'import json,os,sys; keys=json.load(sys.stdin); [open(os.open("/home/ubuntu/" + name, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0o600), "w").write(keys[name]) for name in sys.argv[1:] if name in keys]; sys.exit(0 if all(name in keys for name in sys.argv[1:]) else 1)' host_key.pub worker_key
+do
+  sleep 15
+done
+
+# The worker looks up the current TSA address each time it starts s.t. it
+# follows a replacement web node
+cat > /home/ubuntu/concourse_worker.sh <<'WORKER_SCRIPT'
+#!/bin/bash -e
+TSA_HOST=`aws secretsmanager get-secret-value --region $AWS_REGION --secret-id "$TSA_KEYS_SECRET_ID" --query SecretString --output text | python3 -c 'import json,sys; print(json.load(sys.stdin)["tsa_host"])'`
+exec /home/ubuntu/concourse worker --work-dir /opt/concourse/worker --tsa-host $TSA_HOST --tsa-port 2222 --tsa-public-key /home/ubuntu/host_key.pub --tsa-worker-private-key /home/ubuntu/worker_key
+WORKER_SCRIPT
+chmod +x /home/ubuntu/concourse_worker.sh
+
+################################################################################
+# SUPERVISOR
+# REF: http://supervisord.org/
+mkdir -pv /etc/supervisor/conf.d
+
+CONCOURSE_WORKER_SUPERVISOR_CONF="[program:concourse_worker]
+command=/home/ubuntu/concourse_worker.sh
+environment=AWS_REGION=\"$AWS_REGION\",TSA_KEYS_SECRET_ID=\"$TSA_KEYS_SECRET_ID\"
+numprocs=1
+directory=/tmp
+priority=999
+autostart=true
+autorestart=true
+startsecs=10
+startretries=1000
+exitcodes=0,2
+stopsignal=TERM
+stopwaitsecs=10
+stopasgroup=false
+killasgroup=false
+user=root
+stdout_logfile=/var/log/concourse_worker.log
+stdout_logfile_maxbytes=1MB
+stdout_logfile_backups=10
+stdout_capture_maxbytes=1MB
+stdout_events_enabled=false
+redirect_stderr=false
+stderr_logfile=concourse_worker.err.log
+stderr_logfile_maxbytes=1MB
+stderr_logfile_backups=10
+stderr_capture_maxbytes=1MB
+stderr_events_enabled=false
+"
+echo "$CONCOURSE_WORKER_SUPERVISOR_CONF" > /etc/supervisor/conf.d/concourse_worker.conf
+
+# Startup Supervisor
+service supervisor restart || service supervisor start
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	gocf "github.com/crewjam/go-cloudformation"
+	sparta "github.com/mweagle/Sparta"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+)
+
+const (
+	// Port workers use to register with the TSA on the web node
+	tsaPort = 2222
+)
+
+// tsaKeysSecret describes the secret where the web node shares the TSA
+// keys and address with the worker pool. The keys aren't written to the
+// artifact bucket, which every pipeline can read.
+type tsaKeysSecret struct {
+	// Secret ARN the web and worker instances are allowed to access
+	secretARN *gocf.StringExpr
+	// Secret ID expanded into the userdata
+	userDataSecretID string
+}
+
+// Default instance sizing
+const (
+	defaultInstanceType       = "t2.micro"
+	defaultDBInstanceClass    = "db.t2.micro"
+	defaultDBAllocatedStorage = 10
+)
+
+// Verify the instance sizing options
+func validateSizingOptions() error {
+	if options.DBAllocatedStorage <= 0 {
+		return fmt.Errorf("Invalid --db-allocated-storage value: %d", options.DBAllocatedStorage)
+	}
+	sizeErr := validateASGSize("asg", options.ASGMinSize, options.ASGMaxSize)
+	if nil != sizeErr {
+		return sizeErr
+	}
+	if options.ASGMaxSize > 1 {
+		// Each web node has its own address and external URL
+		if loadBalancerNone == options.LoadBalancer {
+			return fmt.Errorf("--asg-max-size > 1 requires a --load-balancer: %d", options.ASGMaxSize)
+		}
+		// Each web node generates the TSA keys and overwrites the ones the
+		// workers use to register
+		if options.WorkerPool {
+			return fmt.Errorf("--asg-max-size > 1 isn't supported with --worker-pool: %d", options.ASGMaxSize)
+		}
+	}
+	if !options.WorkerPool {
+		return nil
+	}
+	return validateASGSize("worker", options.WorkerMinSize, options.WorkerMaxSize)
+}
+
+// Verify an ASG's MinSize and MaxSize
+func validateASGSize(flagPrefix string, minSize int, maxSize int) error {
+	if minSize < 0 || maxSize < 1 || minSize > maxSize {
+		return fmt.Errorf("Invalid --%s-min-size and --%s-max-size values: %d, %d",
+			flagPrefix,
+			flagPrefix,
+			minSize,
+			maxSize)
+	}
+	return nil
+}
+
+// Add the secret where the web node shares the TSA keys. It's empty until
+// the web node boots and generates the keys.
+func addTSAKeysResources(template *gocf.Template) *tsaKeysSecret {
+	secretResourceName := sparta.CloudFormationResourceName("ConcourseTSAKeysSecret",
+		"ConcourseTSAKeysSecret")
+	template.AddResource(secretResourceName, &secretsManagerSecret{
+		Description:  gocf.String("Concourse TSA keys shared with the worker pool"),
+		SecretString: gocf.String("{}"),
+	})
+	return &tsaKeysSecret{
+		secretARN:        gocf.Ref(secretResourceName).String(),
+		userDataSecretID: fmt.Sprintf(`{ "Ref" : "%s" }`, secretResourceName),
+	}
+}
+
+// workerPool describes the ASG of Concourse workers that register with
+// the TSA on the web node
+type workerPool struct {
+	serviceName                  string
+	tsaKeys                      *tsaKeysSecret
+	amiLookupName                string
+	ec2SecurityGroupResourceName string
+	userDataProps                map[string]interface{}
+}
+
+// Add the worker security group and allow it to reach the TSA
+func (pool *workerPool) addSecurityGroups(template *gocf.Template) string {
+	workerSecurityGroupName := sparta.CloudFormationResourceName("ConcourseWorkerSecurityGroup",
+		"ConcourseWorkerSecurityGroup")
+	var rules gocf.EC2SecurityGroupRuleList
+	if !sshIngressDisabled() {
+		rules = append(rules, cidrIngressRules(options.AllowedSSHCIDRs, sshPort)...)
+	}
+	workerSecurityGroup := &gocf.EC2SecurityGroup{
+		GroupDescription:     gocf.String("Concourse CI/CD workers"),
+		SecurityGroupIngress: &rules,
+	}
+	if isVPCDeployment() {
+		workerSecurityGroup.VpcId = gocf.String(options.VPCID)
+	}
+	template.AddResource(workerSecurityGroupName, workerSecurityGroup)
+
+	// Separate ingress resource s.t. the groups don't reference each other
+	tsaIngressName := sparta.CloudFormationResourceName("ConcourseTSAIngress",
+		"ConcourseTSAIngress")
+	tsaIngress := &gocf.EC2SecurityGroupIngress{
+		IpProtocol: gocf.String("tcp"),
+		FromPort:   gocf.Integer(tsaPort),
+		ToPort:     gocf.Integer(tsaPort),
+	}
+	if isVPCDeployment() {
+		tsaIngress.GroupId = gocf.GetAtt(pool.ec2SecurityGroupResourceName, "GroupId")
+		tsaIngress.SourceSecurityGroupId = gocf.GetAtt(workerSecurityGroupName, "GroupId")
+	} else {
+		tsaIngress.GroupName = gocf.Ref(pool.ec2SecurityGroupResourceName).String()
+		tsaIngress.SourceSecurityGroupName = gocf.Ref(workerSecurityGroupName).String()
+	}
+	template.AddResource(tsaIngressName, tsaIngress)
+	return workerSecurityGroupName
+}
+
+// Add the worker instance role, which can only read the shared TSA keys
+func (pool *workerPool) addInstanceProfile(template *gocf.Template) string {
+	workerRoleName := sparta.CloudFormationResourceName("ConcourseWorkerInstanceRole",
+		"ConcourseWorkerInstanceRole")
+	workerInstanceProfileName := sparta.CloudFormationResourceName("ConcourseWorkerInstanceProfile",
+		"ConcourseWorkerInstanceProfile")
+
+	statements := append([]spartaIAM.PolicyStatement{}, sparta.CommonIAMStatements.Core...)
+	statements = append(statements, spartaIAM.PolicyStatement{
+		Effect:   "Allow",
+		Action:   []string{"secretsmanager:GetSecretValue"},
+		Resource: pool.tsaKeys.secretARN,
+	})
+	if concourseStatement := concourseReleaseStatement(); nil != concourseStatement {
+		statements = append(statements, *concourseStatement)
+	}
+	iamPolicyList := gocf.IAMPoliciesList{
+		gocf.IAMPolicies{
+			PolicyDocument: sparta.ArbitraryJSONObject{
+				"Version":   "2012-10-17",
+				"Statement": statements,
+			},
+			PolicyName: gocf.String("WorkerPolicy"),
+		},
+	}
+	template.AddResource(workerRoleName, &gocf.IAMRole{
+		AssumeRolePolicyDocument: sparta.AssumePolicyDocument,
+		Policies:                 &iamPolicyList,
+	})
+	template.AddResource(workerInstanceProfileName, &gocf.IAMInstanceProfile{
+		Path:  gocf.String("/"),
+		Roles: []gocf.Stringable{gocf.Ref(workerRoleName).String()},
+	})
+	return workerInstanceProfileName
+}
+
+// Add the worker ASG and its supporting resources
+func (pool *workerPool) addResources(template *gocf.Template) error {
+	workerLaunchConfigurationName := sparta.CloudFormationResourceName("ConcourseWorkerLaunchConfig",
+		"ConcourseWorkerLaunchConfig")
+	workerASGResourceName := sparta.CloudFormationResourceName("ConcourseWorkerASG",
+		"ConcourseWorkerASG")
+
+	workerSecurityGroupName := pool.addSecurityGroups(template)
+	workerInstanceProfileName := pool.addInstanceProfile(template)
+
+	userDataExpression, userDataExpressionErr := expandUserData("/resources/source/worker_userdata.sh",
+		pool.userDataProps)
+	if nil != userDataExpressionErr {
+		return userDataExpressionErr
+	}
+	launchConfiguration := &gocf.AutoScalingLaunchConfiguration{
+		ImageId:            gocf.GetAtt(pool.amiLookupName, "HVM"),
+		InstanceType:       gocf.String(options.WorkerInstanceType),
+		KeyName:            gocf.String(options.SSHKeyName),
+		IamInstanceProfile: gocf.Ref(workerInstanceProfileName).String(),
+		UserData:           gocf.Base64(userDataExpression),
+		SecurityGroups:     gocf.StringList(gocf.GetAtt(workerSecurityGroupName, "GroupId")),
+	}
+	launchConfigResource := template.AddResource(workerLaunchConfigurationName, launchConfiguration)
+	launchConfigResource.DependsOn = append(launchConfigResource.DependsOn,
+		pool.amiLookupName)
+
+	workerASG := &gocf.AutoScalingAutoScalingGroup{
+		LaunchConfigurationName: gocf.Ref(workerLaunchConfigurationName).String(),
+		MaxSize:                 gocf.String(fmt.Sprintf("%d", options.WorkerMaxSize)),
+		MinSize:                 gocf.String(fmt.Sprintf("%d", options.WorkerMinSize)),
+	}
+	setASGPlacement(workerASG)
+	template.AddResource(workerASGResourceName, workerASG)
+	addOutput(template, "WorkerASGName", "Concourse worker ASG name",
+		gocf.Ref(workerASGResourceName).String())
+	return nil
+}
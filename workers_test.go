@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateSizingOptions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		asgMinSize   int
+		asgMaxSize   int
+		loadBalancer string
+		workerPool   bool
+		valid        bool
+	}{
+		{"single web node", 1, 1, loadBalancerNone, false, true},
+		{"invalid web sizes", 2, 1, loadBalancerApplication, false, false},
+		{"multiple web nodes behind a load balancer", 1, 3, loadBalancerApplication, false, true},
+		{"multiple web nodes without a load balancer", 1, 3, loadBalancerNone, false, false},
+		{"multiple web nodes with a worker pool", 1, 3, loadBalancerApplication, true, false},
+		{"single web node with a worker pool", 1, 1, loadBalancerNone, true, true},
+	}
+	savedOptions := options
+	defer func() {
+		options = savedOptions
+	}()
+	for _, eachCase := range testCases {
+		options = newTestProvisionOptions()
+		options.ASGMinSize = eachCase.asgMinSize
+		options.ASGMaxSize = eachCase.asgMaxSize
+		options.LoadBalancer = eachCase.loadBalancer
+		options.WorkerPool = eachCase.workerPool
+		options.WorkerMinSize = 1
+		options.WorkerMaxSize = 2
+		validateErr := validateSizingOptions()
+		if eachCase.valid != (nil == validateErr) {
+			t.Fatalf("%s: expected valid=%t, got %v", eachCase.name, eachCase.valid, validateErr)
+		}
+	}
+}
+
+func TestWorkerPoolTSAKeysSecret(t *testing.T) {
+	workerOptions := newTestProvisionOptions()
+	workerOptions.WorkerPool = true
+	workerOptions.WorkerInstanceType = "t2.micro"
+	workerOptions.WorkerMinSize = 1
+	workerOptions.WorkerMaxSize = 2
+
+	var rendered struct {
+		Resources map[string]struct {
+			Properties map[string]json.RawMessage
+		}
+	}
+	renderedErr := json.Unmarshal(decoratedTemplate(t, workerOptions), &rendered)
+	if nil != renderedErr {
+		t.Fatal(renderedErr)
+	}
+	if _, exists := rendered.Resources["ConcourseTSAKeysSecret"]; !exists {
+		t.Fatal("Missing TSA keys secret")
+	}
+	secretRef := `{"Ref":"ConcourseTSAKeysSecret"}`
+	for _, eachRole := range []string{"ConcourseCIEC2InstanceRole", "ConcourseWorkerInstanceRole"} {
+		policiesJSON := string(rendered.Resources[eachRole].Properties["Policies"])
+		if !strings.Contains(policiesJSON, secretRef) {
+			t.Fatalf("%s can't read the TSA keys secret: %s", eachRole, policiesJSON)
+		}
+		if strings.Contains(policiesJSON, "-tsa/") {
+			t.Fatalf("%s has access to TSA keys in the artifact bucket: %s", eachRole, policiesJSON)
+		}
+	}
+	for _, eachLaunchConfig := range []string{"ConcourseCIASGLaunchConfig", "ConcourseWorkerLaunchConfig"} {
+		userData := string(rendered.Resources[eachLaunchConfig].Properties["UserData"])
+		if !strings.Contains(userData, `TSA_KEYS_SECRET_ID={ \"Ref\" : \"ConcourseTSAKeysSecret\" }`) {
+			t.Fatalf("%s userdata doesn't use the TSA keys secret: %s", eachLaunchConfig, userData)
+		}
+		if strings.Contains(userData, "aws s3 cp --region $AWS_REGION /home/ubuntu/") {
+			t.Fatalf("%s userdata copies keys to S3", eachLaunchConfig)
+		}
+	}
+}